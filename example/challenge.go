@@ -1,61 +1,27 @@
 package main
 
 import (
+	"encoding/json"
 	"fmt"
-	"io/ioutil"
 	"net/http"
 	"net/url"
 	"strings"
 	"time"
 
 	"github.com/STNS/libstns-go/libstns"
+	"github.com/STNS/libstns-go/libstns/httpauth"
 )
 
-var stns *libstns.STNS
-
-func challengeCode(w http.ResponseWriter, r *http.Request) {
-	if err := r.ParseForm(); err != nil {
-		panic(err)
-	}
-	code, err := stns.CreateUserChallengeCode(r.FormValue("user"))
-	if err != nil {
-		panic(err)
-	}
-
-	fmt.Fprintf(w, string(code))
-}
-
-func verify(w http.ResponseWriter, r *http.Request) {
-	if err := r.ParseForm(); err != nil {
-		panic(err)
-	}
-
-	err := stns.VerifyWithUser(r.FormValue("user"), []byte(r.FormValue("code")), []byte(r.FormValue("signature")))
-	if err != nil {
-		w.WriteHeader(http.StatusUnauthorized)
-		return
-	}
-	code, err := stns.PopUserChallengeCode(r.FormValue("user"))
-	if err != nil {
-		panic(err)
-	}
-
-	if string(code) == r.FormValue("code") {
-		w.WriteHeader(http.StatusOK)
-		return
-	}
-	w.WriteHeader(http.StatusUnauthorized)
-}
 func main() {
-	s, err := libstns.NewSTNS("https://stns.lolipop.io/v1/", nil)
+	stns, err := libstns.NewSTNS("https://stns.lolipop.io/v1/", nil)
 	if err != nil {
 		panic(err)
 	}
-	stns = s
 
 	go func() {
-		http.HandleFunc("/challenge", challengeCode)
-		http.HandleFunc("/verify", verify)
+		auth := httpauth.New(stns)
+		http.Handle("/challenge", auth.ChallengeHandler())
+		http.Handle("/verify", auth.VerifyHandler())
 		if err := http.ListenAndServe("127.0.0.1:18000", nil); err != nil {
 			panic(err)
 		}
@@ -70,19 +36,19 @@ func main() {
 		panic(err)
 	}
 	defer resp.Body.Close()
-	code, err := ioutil.ReadAll(resp.Body)
-	if err != nil {
+	var challenge httpauth.ChallengeResponse
+	if err := json.NewDecoder(resp.Body).Decode(&challenge); err != nil {
 		panic(err)
 	}
 
-	sig, err := stns.Sign(code)
+	sig, err := stns.Sign([]byte(challenge.Code))
 	if err != nil {
 		panic(err)
 	}
 	values := url.Values{}
 	values.Set("user", "pyama")
 	values.Set("signature", string(sig))
-	values.Add("code", string(code))
+	values.Add("code", challenge.Code)
 
 	req, err := http.NewRequest(
 		"POST",
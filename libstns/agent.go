@@ -0,0 +1,63 @@
+package libstns
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"strings"
+
+	"golang.org/x/crypto/ssh"
+	"golang.org/x/crypto/ssh/agent"
+)
+
+var ErrAgentKeyNotFound = errors.New("ssh-agent key not found")
+
+func (c *STNS) agentSigner() (ssh.Signer, func(), error) {
+	sock := os.Getenv("SSH_AUTH_SOCK")
+	if sock == "" {
+		return nil, nil, errors.New("SSH_AUTH_SOCK is not set")
+	}
+
+	conn, err := net.Dial("unix", sock)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	s, err := selectAgentSigner(agent.NewClient(conn), c.opt.SSHAgentKey)
+	if err != nil {
+		conn.Close()
+		return nil, nil, err
+	}
+	return s, func() { conn.Close() }, nil
+}
+
+// selectAgentSigner picks the agent key whose SHA256 or MD5 fingerprint or
+// comment equals selector, or the first key when selector is empty.
+func selectAgentSigner(a agent.ExtendedAgent, selector string) (ssh.Signer, error) {
+	keys, err := a.List()
+	if err != nil {
+		return nil, err
+	}
+
+	signers, err := a.Signers()
+	if err != nil {
+		return nil, err
+	}
+
+	for _, k := range keys {
+		if selector != "" &&
+			k.Comment != selector &&
+			ssh.FingerprintSHA256(k) != selector &&
+			ssh.FingerprintLegacyMD5(k) != strings.TrimPrefix(selector, "MD5:") {
+			continue
+		}
+
+		for _, s := range signers {
+			if string(s.PublicKey().Marshal()) == string(k.Marshal()) {
+				return s, nil
+			}
+		}
+	}
+	return nil, fmt.Errorf("%w: %s", ErrAgentKeyNotFound, selector)
+}
@@ -0,0 +1,135 @@
+package libstns
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"encoding/json"
+	"io/ioutil"
+	"net"
+	"path/filepath"
+	"testing"
+
+	"golang.org/x/crypto/ssh"
+	"golang.org/x/crypto/ssh/agent"
+)
+
+func startTestAgent(t *testing.T, keys ...agent.AddedKey) string {
+	keyring := agent.NewKeyring()
+	for _, k := range keys {
+		if err := keyring.Add(k); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	sock := filepath.Join(t.TempDir(), "agent.sock")
+	l, err := net.Listen("unix", sock)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { l.Close() })
+
+	go func() {
+		for {
+			conn, err := l.Accept()
+			if err != nil {
+				return
+			}
+			go func() {
+				defer conn.Close()
+				agent.ServeAgent(keyring, conn)
+			}()
+		}
+	}()
+	return sock
+}
+
+func TestSTNS_SignWithAgent(t *testing.T) {
+	_, edKey, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	edSigner, err := ssh.NewSignerFromKey(edKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	b, err := ioutil.ReadFile("./testdata/id_rsa")
+	if err != nil {
+		t.Fatal(err)
+	}
+	rsaKey, err := ssh.ParseRawPrivateKeyWithPassphrase(b, []byte("test"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	rsaSigner, err := ssh.NewSignerFromKey(rsaKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	sock := startTestAgent(t,
+		agent.AddedKey{PrivateKey: edKey, Comment: "ed25519 key"},
+		agent.AddedKey{PrivateKey: rsaKey, Comment: "rsa key"},
+	)
+
+	tests := []struct {
+		name     string
+		sock     string
+		selector string
+		want     ssh.PublicKey
+	}{
+		{
+			name: "first key",
+			sock: sock,
+			want: edSigner.PublicKey(),
+		},
+		{
+			name:     "by comment",
+			sock:     sock,
+			selector: "rsa key",
+			want:     rsaSigner.PublicKey(),
+		},
+		{
+			name:     "by fingerprint",
+			sock:     sock,
+			selector: ssh.FingerprintSHA256(rsaSigner.PublicKey()),
+			want:     rsaSigner.PublicKey(),
+		},
+		{
+			name:     "fallback to key file when not found",
+			sock:     sock,
+			selector: "missing key",
+			want:     rsaSigner.PublicKey(),
+		},
+		{
+			name: "fallback to key file when agent unavailable",
+			sock: filepath.Join(t.TempDir(), "missing.sock"),
+			want: rsaSigner.PublicKey(),
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Setenv("SSH_AUTH_SOCK", tt.sock)
+			c := &STNS{
+				opt: &Options{
+					PrivatekeyPath:     "./testdata/id_rsa",
+					PrivatekeyPassword: "test",
+					SSHAgent:           true,
+					SSHAgentKey:        tt.selector,
+				},
+			}
+
+			got, err := c.Sign([]byte("test"))
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			var sig ssh.Signature
+			if err := json.Unmarshal(got, &sig); err != nil {
+				t.Fatal(err)
+			}
+			if err := tt.want.Verify([]byte("test"), &sig); err != nil {
+				t.Errorf("STNS.Sign() signature does not match the wanted key: %v", err)
+			}
+		})
+	}
+}
@@ -0,0 +1,281 @@
+package libstns
+
+import (
+	"container/list"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/STNS/STNS/v2/model"
+)
+
+var DefaultCacheTTL = 600
+var DefaultNegativeCacheTTL = 10
+var DefaultCacheSize = 10000
+
+type CacheStats struct {
+	Hits    uint64
+	Misses  uint64
+	Entries int
+}
+
+type cacheEntry struct {
+	key    string
+	value  interface{}
+	expire time.Time
+}
+
+// cache is a size bounded LRU cache with separate TTLs for found and not
+// found entries. A nil value in an entry means a negative (not found) result.
+type cache struct {
+	mu          sync.Mutex
+	ttl         time.Duration
+	negativeTTL time.Duration
+	size        int
+	ll          *list.List
+	items       map[string]*list.Element
+	hits        uint64
+	misses      uint64
+}
+
+func newCache(opt *Options) *cache {
+	if opt.CacheTTL == 0 {
+		opt.CacheTTL = DefaultCacheTTL
+	}
+
+	if opt.CacheNegativeTTL == 0 {
+		opt.CacheNegativeTTL = DefaultNegativeCacheTTL
+	}
+
+	if opt.CacheSize == 0 {
+		opt.CacheSize = DefaultCacheSize
+	}
+
+	return newLRUCache(
+		time.Duration(opt.CacheTTL)*time.Second,
+		time.Duration(opt.CacheNegativeTTL)*time.Second,
+		opt.CacheSize,
+	)
+}
+
+func newLRUCache(ttl, negativeTTL time.Duration, size int) *cache {
+	return &cache{
+		ttl:         ttl,
+		negativeTTL: negativeTTL,
+		size:        size,
+		ll:          list.New(),
+		items:       map[string]*list.Element{},
+	}
+}
+
+func (c *cache) get(key string) (interface{}, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	e, ok := c.items[key]
+	if !ok {
+		c.misses++
+		return nil, false
+	}
+
+	entry := e.Value.(*cacheEntry)
+	if time.Now().After(entry.expire) {
+		c.removeElement(e)
+		c.misses++
+		return nil, false
+	}
+
+	c.ll.MoveToFront(e)
+	c.hits++
+	return entry.value, true
+}
+
+func (c *cache) set(key string, value interface{}) {
+	ttl := c.ttl
+	if value == nil {
+		ttl = c.negativeTTL
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	expire := time.Now().Add(ttl)
+	if e, ok := c.items[key]; ok {
+		entry := e.Value.(*cacheEntry)
+		entry.value = value
+		entry.expire = expire
+		c.ll.MoveToFront(e)
+		return
+	}
+
+	c.items[key] = c.ll.PushFront(&cacheEntry{
+		key:    key,
+		value:  value,
+		expire: expire,
+	})
+
+	for c.ll.Len() > c.size {
+		c.removeElement(c.ll.Back())
+	}
+}
+
+func (c *cache) peek(key string) interface{} {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if e, ok := c.items[key]; ok {
+		return e.Value.(*cacheEntry).value
+	}
+	return nil
+}
+
+func (c *cache) delete(key string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if e, ok := c.items[key]; ok {
+		c.removeElement(e)
+	}
+}
+
+func (c *cache) purge() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.ll.Init()
+	c.items = map[string]*list.Element{}
+}
+
+func (c *cache) stats() CacheStats {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	return CacheStats{
+		Hits:    c.hits,
+		Misses:  c.misses,
+		Entries: c.ll.Len(),
+	}
+}
+
+func (c *cache) removeElement(e *list.Element) {
+	c.ll.Remove(e)
+	delete(c.items, e.Value.(*cacheEntry).key)
+}
+
+func userNameKey(name string) string {
+	return fmt.Sprintf("user/name/%s", name)
+}
+
+func userIDKey(id int) string {
+	return fmt.Sprintf("user/id/%d", id)
+}
+
+func groupNameKey(name string) string {
+	return fmt.Sprintf("group/name/%s", name)
+}
+
+func groupIDKey(id int) string {
+	return fmt.Sprintf("group/id/%d", id)
+}
+
+func (s *STNS) cachedUser(key string) (*model.User, bool, error) {
+	if s.cache == nil {
+		return nil, false, nil
+	}
+
+	v, ok := s.cache.get(key)
+	if !ok {
+		return nil, false, nil
+	}
+
+	if v == nil {
+		return nil, true, ErrUserNotFound
+	}
+	return v.(*model.User), true, nil
+}
+
+func (s *STNS) storeUser(key string, user *model.User, err error) {
+	if s.cache == nil {
+		return
+	}
+
+	switch {
+	case err == nil:
+		s.cache.set(userNameKey(user.Name), user)
+		s.cache.set(userIDKey(user.ID), user)
+	case err == ErrUserNotFound:
+		s.cache.set(key, nil)
+	}
+}
+
+func (s *STNS) cachedGroup(key string) (*model.Group, bool, error) {
+	if s.cache == nil {
+		return nil, false, nil
+	}
+
+	v, ok := s.cache.get(key)
+	if !ok {
+		return nil, false, nil
+	}
+
+	if v == nil {
+		return nil, true, ErrGroupNotFound
+	}
+	return v.(*model.Group), true, nil
+}
+
+func (s *STNS) storeGroup(key string, group *model.Group, err error) {
+	if s.cache == nil {
+		return
+	}
+
+	switch {
+	case err == nil:
+		s.cache.set(groupNameKey(group.Name), group)
+		s.cache.set(groupIDKey(group.ID), group)
+	case err == ErrGroupNotFound:
+		s.cache.set(key, nil)
+	}
+}
+
+// InvalidateUser drops the cached entries for the named user, including the
+// entry indexed by its ID and the cached user list.
+func (s *STNS) InvalidateUser(name string) {
+	if s.cache == nil {
+		return
+	}
+
+	if u, ok := s.cache.peek(userNameKey(name)).(*model.User); ok {
+		s.cache.delete(userIDKey(u.ID))
+	}
+	s.cache.delete(userNameKey(name))
+	s.cache.delete(userListKey)
+}
+
+// InvalidateGroup drops the cached entries for the named group, including
+// the entry indexed by its ID and the cached group list.
+func (s *STNS) InvalidateGroup(name string) {
+	if s.cache == nil {
+		return
+	}
+
+	if g, ok := s.cache.peek(groupNameKey(name)).(*model.Group); ok {
+		s.cache.delete(groupIDKey(g.ID))
+	}
+	s.cache.delete(groupNameKey(name))
+	s.cache.delete(groupListKey)
+}
+
+func (s *STNS) PurgeCache() {
+	if s.cache == nil {
+		return
+	}
+	s.cache.purge()
+}
+
+func (s *STNS) CacheStats() CacheStats {
+	if s.cache == nil {
+		return CacheStats{}
+	}
+	return s.cache.stats()
+}
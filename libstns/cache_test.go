@@ -0,0 +1,124 @@
+package libstns
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/STNS/STNS/v2/model"
+)
+
+func TestCache_Eviction(t *testing.T) {
+	c := newCache(&Options{CacheSize: 2})
+	c.set("a", 1)
+	c.set("b", 2)
+	if _, ok := c.get("a"); !ok {
+		t.Fatal("cache.get(a) miss")
+	}
+	c.set("c", 3)
+
+	if _, ok := c.get("b"); ok {
+		t.Error("cache.get(b) hit, want evicted")
+	}
+	if _, ok := c.get("a"); !ok {
+		t.Error("cache.get(a) miss, want hit")
+	}
+	if _, ok := c.get("c"); !ok {
+		t.Error("cache.get(c) miss, want hit")
+	}
+
+	st := c.stats()
+	if st.Hits != 3 || st.Misses != 1 || st.Entries != 2 {
+		t.Errorf("cache.stats() = %+v", st)
+	}
+}
+
+func TestCache_TTL(t *testing.T) {
+	c := newCache(&Options{})
+	c.ttl = time.Hour
+	c.negativeTTL = time.Millisecond
+	c.set("found", 1)
+	c.set("notfound", nil)
+
+	time.Sleep(10 * time.Millisecond)
+	if _, ok := c.get("found"); !ok {
+		t.Error("cache.get(found) miss, want hit")
+	}
+	if _, ok := c.get("notfound"); ok {
+		t.Error("cache.get(notfound) hit, want expired")
+	}
+}
+
+func TestSTNS_Cache(t *testing.T) {
+	var requests int32
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&requests, 1)
+		users := []*model.User{
+			{Base: model.Base{ID: 1, Name: "example1"}},
+			{Base: model.Base{ID: 2, Name: "example2"}},
+		}
+		switch r.URL.String() {
+		case "/users":
+		case "/users?name=example1", "/users?id=1":
+			users = users[:1]
+		default:
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		rp, err := json.Marshal(users)
+		if err != nil {
+			t.Error(err)
+		}
+		fmt.Fprint(w, string(rp))
+	}))
+	defer ts.Close()
+
+	s, err := NewSTNS(ts.URL, &Options{Cache: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := s.ListUser(); err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 2; i++ {
+		if u, err := s.GetUserByName("example2"); err != nil || u.ID != 2 {
+			t.Errorf("STNS.GetUserByName() = %v, %v", u, err)
+		}
+		if u, err := s.GetUserByID(1); err != nil || u.Name != "example1" {
+			t.Errorf("STNS.GetUserByID() = %v, %v", u, err)
+		}
+		if _, err := s.GetUserByName("missing"); !errors.Is(err, ErrUserNotFound) {
+			t.Errorf("STNS.GetUserByName() error = %v, want %v", err, ErrUserNotFound)
+		}
+	}
+	if n := atomic.LoadInt32(&requests); n != 2 {
+		t.Errorf("requests = %d, want 2", n)
+	}
+
+	s.InvalidateUser("example1")
+	if _, err := s.GetUserByID(1); err != nil {
+		t.Fatal(err)
+	}
+	if n := atomic.LoadInt32(&requests); n != 3 {
+		t.Errorf("requests = %d, want 3", n)
+	}
+
+	s.PurgeCache()
+	if _, err := s.GetUserByName("example1"); err != nil {
+		t.Fatal(err)
+	}
+	if n := atomic.LoadInt32(&requests); n != 4 {
+		t.Errorf("requests = %d, want 4", n)
+	}
+
+	st := s.CacheStats()
+	if st.Hits != 5 || st.Misses != 3 {
+		t.Errorf("STNS.CacheStats() = %+v", st)
+	}
+}
@@ -0,0 +1,188 @@
+package libstns
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os/user"
+	"strings"
+
+	"github.com/thoas/go-funk"
+	"golang.org/x/crypto/ssh"
+)
+
+const sourceAddressCriticalOption = "source-address"
+
+var ErrCertificateRejected = errors.New("certificate rejected")
+
+func (c *STNS) VerifyCertificate(name string, msg, certBytes, signature []byte) error {
+	return c.VerifyCertificateContext(context.Background(), name, msg, certBytes, signature)
+}
+
+// VerifyCertificateContext verifies a signature made by the key of an
+// OpenSSH user certificate. The certificate must be signed by one of the
+// CA keys in Options.TrustedUserCAKeys and list name as a principal. A
+// source-address critical option, once allowed by Options.CertCriticalOptions,
+// must match the address set with WithClientAddress.
+func (c *STNS) VerifyCertificateContext(ctx context.Context, name string, msg, certBytes, signature []byte) error {
+	if _, err := c.GetUserByNameContext(ctx, name); err != nil {
+		return err
+	}
+
+	publicKey, _, _, _, err := ssh.ParseAuthorizedKey(certBytes)
+	if err != nil {
+		return fmt.Errorf("can't read certificate %s", err.Error())
+	}
+
+	cert, ok := publicKey.(*ssh.Certificate)
+	if !ok {
+		return fmt.Errorf("%w: not a certificate", ErrCertificateRejected)
+	}
+	return c.verifyCertificate(ctx, name, msg, cert, signature)
+}
+
+func (c *STNS) verifyCertificate(ctx context.Context, name string, msg []byte, cert *ssh.Certificate, signature []byte) error {
+	if err := c.checkCertificate(ctx, name, cert); err != nil {
+		return err
+	}
+
+	if err := c.checkKeyPolicy(cert); err != nil {
+		return err
+	}
+
+	if isSSHSIG(signature) {
+		format, err := sshsigFormat(signature)
+		if err != nil {
+			return err
+		}
+
+		if err := c.checkSignaturePolicy(format); err != nil {
+			return err
+		}
+
+		signer, err := VerifySSHSIG(msg, signature, c.signatureNamespace())
+		if err != nil {
+			return err
+		}
+
+		if !bytes.Equal(signer.Marshal(), cert.Marshal()) && !bytes.Equal(signer.Marshal(), cert.Key.Marshal()) {
+			return ErrVerifyFailed
+		}
+		return nil
+	}
+
+	var sig ssh.Signature
+	if err := json.Unmarshal(signature, &sig); err != nil {
+		return err
+	}
+
+	if err := c.checkSignaturePolicy(sig.Format); err != nil {
+		return err
+	}
+
+	if err := cert.Key.Verify(msg, &sig); err != nil {
+		return ErrVerifyFailed
+	}
+	return nil
+}
+
+// sshsigCertificate returns the certificate embedded in an SSHSIG signature,
+// if any.
+func sshsigCertificate(signature []byte) (*ssh.Certificate, bool) {
+	if !isSSHSIG(signature) {
+		return nil, false
+	}
+
+	_, publicKey, err := parseSSHSIG(signature)
+	if err != nil {
+		return nil, false
+	}
+
+	cert, ok := publicKey.(*ssh.Certificate)
+	return cert, ok
+}
+
+func (c *STNS) checkCertificate(ctx context.Context, name string, cert *ssh.Certificate) error {
+	if cert.CertType != ssh.UserCert {
+		return fmt.Errorf("%w: not a user certificate", ErrCertificateRejected)
+	}
+
+	cas, err := c.trustedUserCAKeys()
+	if err != nil {
+		return err
+	}
+
+	trusted := false
+	for _, ca := range cas {
+		if bytes.Equal(ca.Marshal(), cert.SignatureKey.Marshal()) {
+			trusted = true
+			break
+		}
+	}
+	if !trusted {
+		return fmt.Errorf("%w: signed by an untrusted authority", ErrCertificateRejected)
+	}
+
+	// Unlike ssh.CertChecker, a certificate without principals is not valid
+	// for every user.
+	if len(cert.ValidPrincipals) == 0 {
+		return fmt.Errorf("%w: no principals", ErrCertificateRejected)
+	}
+
+	supported := c.opt.CertCriticalOptions
+	if value, ok := cert.CriticalOptions[sourceAddressCriticalOption]; ok {
+		// ssh.CertChecker leaves source-address to the caller, so reject it
+		// unless it is explicitly supported, and then check it here against
+		// the client address like from= of authorized keys.
+		if !funk.ContainsString(supported, sourceAddressCriticalOption) {
+			return fmt.Errorf("%w: unsupported critical option %q", ErrCertificateRejected, sourceAddressCriticalOption)
+		}
+
+		addr := clientAddress(ctx)
+		if addr == nil {
+			return fmt.Errorf("%w: source-address requires the client address", ErrCertificateRejected)
+		}
+
+		if !matchAddressList(addr, value) {
+			return fmt.Errorf("%w: %s is not allowed by source-address=%q", ErrCertificateRejected, addr, value)
+		}
+	}
+
+	checker := &ssh.CertChecker{
+		SupportedCriticalOptions: supported,
+		IsRevoked: func(cert *ssh.Certificate) bool {
+			return funk.ContainsUInt64(c.opt.RevokedCertSerials, cert.Serial)
+		},
+	}
+	if err := checker.CheckCert(name, cert); err != nil {
+		return fmt.Errorf("%w: %s", ErrCertificateRejected, err.Error())
+	}
+	return nil
+}
+
+func (c *STNS) trustedUserCAKeys() ([]ssh.PublicKey, error) {
+	if c.opt == nil || c.opt.TrustedUserCAKeys == "" {
+		return nil, fmt.Errorf("%w: no trusted user CA keys", ErrCertificateRejected)
+	}
+
+	usr, _ := user.Current()
+	b, err := ioutil.ReadFile(strings.Replace(c.opt.TrustedUserCAKeys, "~", usr.HomeDir, 1))
+	if err != nil {
+		return nil, fmt.Errorf("error:%s path:%s", err.Error(), c.opt.TrustedUserCAKeys)
+	}
+
+	keys := []ssh.PublicKey{}
+	b = bytes.TrimSpace(b)
+	for len(b) > 0 {
+		publicKey, _, _, rest, err := ssh.ParseAuthorizedKey(b)
+		if err != nil {
+			return nil, fmt.Errorf("can't read CA key %s", err.Error())
+		}
+		keys = append(keys, publicKey)
+		b = bytes.TrimSpace(rest)
+	}
+	return keys, nil
+}
@@ -0,0 +1,268 @@
+package libstns
+
+import (
+	"context"
+	"crypto/ed25519"
+	"crypto/rand"
+	"errors"
+	"io/ioutil"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"golang.org/x/crypto/ssh"
+)
+
+func newTestSigner(t *testing.T) ssh.Signer {
+	_, priv, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	s, err := ssh.NewSignerFromKey(priv)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return s
+}
+
+func TestSTNS_VerifyCertificate(t *testing.T) {
+	var requests int32
+	ts := newMembershipServer(t, &requests)
+	defer ts.Close()
+
+	ca := newTestSigner(t)
+	otherCA := newTestSigner(t)
+
+	caFile := filepath.Join(t.TempDir(), "ca.pub")
+	if err := ioutil.WriteFile(caFile, ssh.MarshalAuthorizedKey(ca.PublicKey()), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	now := time.Now()
+	tests := []struct {
+		name      string
+		user      string
+		cert      ssh.Certificate
+		authority ssh.Signer
+		format    string
+		supported []string
+		address   string
+		wantErr   error
+	}{
+		{
+			name: "ok",
+			user: "alice",
+			cert: ssh.Certificate{
+				ValidPrincipals: []string{"alice"},
+				ValidBefore:     ssh.CertTimeInfinity,
+			},
+		},
+		{
+			name:   "ok sshsig",
+			user:   "alice",
+			format: SignatureFormatSSHSIG,
+			cert: ssh.Certificate{
+				ValidPrincipals: []string{"alice"},
+				ValidBefore:     ssh.CertTimeInfinity,
+			},
+		},
+		{
+			name:      "untrusted authority",
+			user:      "alice",
+			authority: otherCA,
+			cert: ssh.Certificate{
+				ValidPrincipals: []string{"alice"},
+				ValidBefore:     ssh.CertTimeInfinity,
+			},
+			wantErr: ErrCertificateRejected,
+		},
+		{
+			name:   "principal unmatch",
+			user:   "alice",
+			format: SignatureFormatSSHSIG,
+			cert: ssh.Certificate{
+				ValidPrincipals: []string{"bob"},
+				ValidBefore:     ssh.CertTimeInfinity,
+			},
+			wantErr: ErrCertificateRejected,
+		},
+		{
+			name: "no principals",
+			user: "alice",
+			cert: ssh.Certificate{
+				ValidBefore: ssh.CertTimeInfinity,
+			},
+			wantErr: ErrCertificateRejected,
+		},
+		{
+			name: "expired",
+			user: "alice",
+			cert: ssh.Certificate{
+				ValidPrincipals: []string{"alice"},
+				ValidAfter:      uint64(now.Add(-2 * time.Hour).Unix()),
+				ValidBefore:     uint64(now.Add(-time.Hour).Unix()),
+			},
+			wantErr: ErrCertificateRejected,
+		},
+		{
+			name: "not yet valid",
+			user: "alice",
+			cert: ssh.Certificate{
+				ValidPrincipals: []string{"alice"},
+				ValidAfter:      uint64(now.Add(time.Hour).Unix()),
+				ValidBefore:     ssh.CertTimeInfinity,
+			},
+			wantErr: ErrCertificateRejected,
+		},
+		{
+			name: "revoked",
+			user: "alice",
+			cert: ssh.Certificate{
+				Serial:          10,
+				ValidPrincipals: []string{"alice"},
+				ValidBefore:     ssh.CertTimeInfinity,
+			},
+			wantErr: ErrCertificateRejected,
+		},
+		{
+			name: "unsupported critical option",
+			user: "alice",
+			cert: ssh.Certificate{
+				ValidPrincipals: []string{"alice"},
+				ValidBefore:     ssh.CertTimeInfinity,
+				Permissions: ssh.Permissions{
+					CriticalOptions: map[string]string{"verify-required": ""},
+				},
+			},
+			wantErr: ErrCertificateRejected,
+		},
+		{
+			name: "supported critical option",
+			user: "alice",
+			cert: ssh.Certificate{
+				ValidPrincipals: []string{"alice"},
+				ValidBefore:     ssh.CertTimeInfinity,
+				Permissions: ssh.Permissions{
+					CriticalOptions: map[string]string{"force-command": "/bin/true"},
+				},
+			},
+		},
+		{
+			name: "source-address",
+			user: "alice",
+			cert: ssh.Certificate{
+				ValidPrincipals: []string{"alice"},
+				ValidBefore:     ssh.CertTimeInfinity,
+				Permissions: ssh.Permissions{
+					CriticalOptions: map[string]string{"source-address": "10.0.0.0/8"},
+				},
+			},
+			wantErr: ErrCertificateRejected,
+		},
+		{
+			name:      "source-address supported",
+			user:      "alice",
+			supported: []string{"source-address"},
+			address:   "10.1.2.3:22",
+			cert: ssh.Certificate{
+				ValidPrincipals: []string{"alice"},
+				ValidBefore:     ssh.CertTimeInfinity,
+				Permissions: ssh.Permissions{
+					CriticalOptions: map[string]string{"source-address": "10.0.0.0/8"},
+				},
+			},
+		},
+		{
+			name:      "source-address unmatch",
+			user:      "alice",
+			format:    SignatureFormatSSHSIG,
+			supported: []string{"source-address"},
+			address:   "192.168.1.1",
+			cert: ssh.Certificate{
+				ValidPrincipals: []string{"alice"},
+				ValidBefore:     ssh.CertTimeInfinity,
+				Permissions: ssh.Permissions{
+					CriticalOptions: map[string]string{"source-address": "10.0.0.0/8"},
+				},
+			},
+			wantErr: ErrCertificateRejected,
+		},
+		{
+			name:      "source-address without client address",
+			user:      "alice",
+			supported: []string{"source-address"},
+			cert: ssh.Certificate{
+				ValidPrincipals: []string{"alice"},
+				ValidBefore:     ssh.CertTimeInfinity,
+				Permissions: ssh.Permissions{
+					CriticalOptions: map[string]string{"source-address": "10.0.0.0/8"},
+				},
+			},
+			wantErr: ErrCertificateRejected,
+		},
+		{
+			name: "user not found",
+			user: "dave",
+			cert: ssh.Certificate{
+				ValidPrincipals: []string{"dave"},
+				ValidBefore:     ssh.CertTimeInfinity,
+			},
+			wantErr: ErrUserNotFound,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			key := newTestSigner(t)
+			cert := tt.cert
+			cert.Key = key.PublicKey()
+			cert.CertType = ssh.UserCert
+
+			authority := tt.authority
+			if authority == nil {
+				authority = ca
+			}
+			if err := cert.SignCert(rand.Reader, authority); err != nil {
+				t.Fatal(err)
+			}
+
+			certSigner, err := ssh.NewCertSigner(&cert, key)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			s, err := NewSTNS(ts.URL, &Options{
+				TrustedUserCAKeys:   caFile,
+				CertCriticalOptions: append([]string{"force-command"}, tt.supported...),
+				RevokedCertSerials:  []uint64{10},
+				SignatureFormat:     tt.format,
+			})
+			if err != nil {
+				t.Fatal(err)
+			}
+			s.SetSigner(certSigner)
+
+			sig, err := s.Sign([]byte("test"))
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			ctx := context.Background()
+			if tt.address != "" {
+				ctx = WithClientAddress(ctx, tt.address)
+			}
+
+			if tt.format == SignatureFormatSSHSIG {
+				err = s.VerifyWithUserContext(ctx, tt.user, []byte("test"), sig)
+			} else {
+				err = s.VerifyCertificateContext(ctx, tt.user, []byte("test"), ssh.MarshalAuthorizedKey(&cert), sig)
+			}
+
+			if tt.wantErr == nil && err != nil {
+				t.Errorf("STNS.VerifyCertificate() error = %v", err)
+			}
+			if tt.wantErr != nil && !errors.Is(err, tt.wantErr) {
+				t.Errorf("STNS.VerifyCertificate() error = %v, want %v", err, tt.wantErr)
+			}
+		})
+	}
+}
@@ -0,0 +1,201 @@
+package libstns
+
+import (
+	"bytes"
+	"crypto/subtle"
+	"errors"
+	"strconv"
+	"time"
+)
+
+var DefaultChallengeTTL = 300
+
+var (
+	ErrChallengeNotFound = errors.New("challenge code not found")
+	ErrChallengeExpired  = errors.New("challenge code expired")
+	ErrChallengeMismatch = errors.New("challenge code does not match")
+)
+
+// ChallengeStore keeps the outstanding challenge code of each user.
+//
+// The stored value is opaque: STNS embeds the expiry in it and rejects
+// expired codes on Take, so implementations only need to drop entries
+// after ttl to reclaim space.
+type ChallengeStore interface {
+	// Put stores code for user. A store may replace the previous code
+	// or keep several outstanding codes per user.
+	Put(user string, code []byte, ttl time.Duration) error
+	// Take returns the most recently stored code for user and removes
+	// every code stored for user, so that a code can be taken at most once
+	// and an older code is never accepted after a newer one. It returns
+	// ErrChallengeNotFound when no code is stored.
+	Take(user string) ([]byte, error)
+}
+
+// MatchingChallengeStore is a ChallengeStore that can keep several
+// outstanding codes per user and take the one a client presents.
+type MatchingChallengeStore interface {
+	ChallengeStore
+	// TakeMatch removes and returns a stored code of user for which match
+	// returns true, leaving the other codes in place. It returns
+	// ErrChallengeNotFound when no code matches.
+	TakeMatch(user string, match func(code []byte) bool) ([]byte, error)
+}
+
+// FuncChallengeStore adapts a pair of store and pop functions, such as the
+// ones set with SetStoreChallengeCode and SetPopChallengeCode, to a
+// ChallengeStore.
+type FuncChallengeStore struct {
+	StoreFunc func(string, []byte) error
+	PopFunc   func(string) ([]byte, error)
+}
+
+func (f *FuncChallengeStore) Put(user string, code []byte, _ time.Duration) error {
+	return f.StoreFunc(user, code)
+}
+
+func (f *FuncChallengeStore) Take(user string) ([]byte, error) {
+	return f.PopFunc(user)
+}
+
+func (s *STNS) SetChallengeStore(cs ChallengeStore) {
+	s.challengeStore = cs
+}
+
+func (s *STNS) SetStoreChallengeCode(f func(string, []byte) error) {
+	s.storeChallengeCode = f
+	s.challengeStore = nil
+}
+
+func (s *STNS) SetPopChallengeCode(f func(string) ([]byte, error)) {
+	s.popChallengeCode = f
+	s.challengeStore = nil
+}
+
+func (s *STNS) challenges() ChallengeStore {
+	if s.challengeStore != nil {
+		return s.challengeStore
+	}
+
+	f := &FuncChallengeStore{
+		StoreFunc: s.storeChallengeCode,
+		PopFunc:   s.popChallengeCode,
+	}
+	// Fill in whichever function is missing from the file store in
+	// Options.ChallengeDir.
+	fs := NewFileChallengeStore(s.challengeDir())
+	if f.StoreFunc == nil {
+		f.StoreFunc = func(user string, code []byte) error {
+			return fs.Put(user, code, 0)
+		}
+	}
+	if f.PopFunc == nil {
+		f.PopFunc = fs.Take
+	}
+	return f
+}
+
+func (s *STNS) challengeDir() string {
+	if s.opt == nil {
+		return ""
+	}
+	return s.opt.ChallengeDir
+}
+
+func (s *STNS) challengeTTL() time.Duration {
+	if s.opt == nil || s.opt.ChallengeTTL == 0 {
+		return time.Duration(DefaultChallengeTTL) * time.Second
+	}
+	return time.Duration(s.opt.ChallengeTTL) * time.Second
+}
+
+func (s *STNS) CreateUserChallengeCode(name string) ([]byte, error) {
+	if err := ValidateName(name); err != nil {
+		return nil, err
+	}
+
+	code, err := s.makeChallengeCode()
+	if err != nil {
+		return nil, err
+	}
+
+	ttl := s.challengeTTL()
+	if err := s.challenges().Put(name, encodeChallenge(code, time.Now().Add(ttl)), ttl); err != nil {
+		return nil, err
+	}
+	return code, nil
+}
+
+// PopUserChallengeCode takes the outstanding challenge code of the user. It
+// returns ErrChallengeExpired if the code outlived Options.ChallengeTTL.
+func (s *STNS) PopUserChallengeCode(name string) ([]byte, error) {
+	b, err := s.challenges().Take(name)
+	if err != nil {
+		return nil, err
+	}
+	return decodeChallenge(b, time.Now())
+}
+
+// TakeUserChallengeCode consumes code if it is an outstanding challenge
+// code of the user. With a MatchingChallengeStore any outstanding code of
+// the user can be redeemed. Other stores only hand out the latest code,
+// which is consumed even if it does not match, and ErrChallengeMismatch is
+// returned.
+func (s *STNS) TakeUserChallengeCode(name string, code []byte) error {
+	if m, ok := s.challenges().(MatchingChallengeStore); ok {
+		b, err := m.TakeMatch(name, func(b []byte) bool {
+			_, stored, ok := splitChallenge(b)
+			return ok && subtle.ConstantTimeCompare(stored, code) == 1
+		})
+		if err != nil {
+			return err
+		}
+
+		_, err = decodeChallenge(b, time.Now())
+		return err
+	}
+
+	stored, err := s.PopUserChallengeCode(name)
+	if err != nil {
+		return err
+	}
+
+	if subtle.ConstantTimeCompare(stored, code) != 1 {
+		return ErrChallengeMismatch
+	}
+	return nil
+}
+
+// encodeChallenge prefixes code with its expiry as unix seconds.
+func encodeChallenge(code []byte, expire time.Time) []byte {
+	b := strconv.AppendInt(nil, expire.Unix(), 10)
+	b = append(b, ':')
+	return append(b, code...)
+}
+
+func decodeChallenge(b []byte, now time.Time) ([]byte, error) {
+	expire, code, ok := splitChallenge(b)
+	if !ok {
+		return nil, ErrChallengeNotFound
+	}
+
+	if now.Unix() >= expire {
+		return nil, ErrChallengeExpired
+	}
+	return code, nil
+}
+
+// splitChallenge splits an encoded challenge into its expiry and code
+// without checking the expiry.
+func splitChallenge(b []byte) (int64, []byte, bool) {
+	i := bytes.IndexByte(b, ':')
+	if i < 0 {
+		return 0, nil, false
+	}
+
+	expire, err := strconv.ParseInt(string(b[:i]), 10, 64)
+	if err != nil {
+		return 0, nil, false
+	}
+	return expire, b[i+1:], true
+}
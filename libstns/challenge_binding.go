@@ -0,0 +1,201 @@
+package libstns
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const challengeVersion = "stns-challenge-v1"
+const maxAudienceLength = 255
+
+var DefaultChallengeClockSkew = 30
+
+var ErrInvalidChallenge = errors.New("invalid challenge")
+
+// Challenge binds a nonce to a user, the service that issued it and a time
+// window. Its canonical serialization returned by Bytes is what the client
+// signs, so a signature cannot be replayed for another user, service or
+// window.
+type Challenge struct {
+	Nonce     string
+	User      string
+	Audience  string
+	IssuedAt  time.Time
+	ExpiresAt time.Time
+}
+
+// Bytes returns the canonical serialization of the challenge:
+//
+//	stns-challenge-v1
+//	nonce=<base64url>
+//	user=<name>
+//	aud=<audience>
+//	iat=<unix seconds>
+//	exp=<unix seconds>
+//
+// Each line ends with a newline.
+func (c *Challenge) Bytes() []byte {
+	var buf bytes.Buffer
+	buf.WriteString(challengeVersion + "\n")
+	buf.WriteString("nonce=" + c.Nonce + "\n")
+	buf.WriteString("user=" + c.User + "\n")
+	buf.WriteString("aud=" + c.Audience + "\n")
+	buf.WriteString("iat=" + strconv.FormatInt(c.IssuedAt.Unix(), 10) + "\n")
+	buf.WriteString("exp=" + strconv.FormatInt(c.ExpiresAt.Unix(), 10) + "\n")
+	return buf.Bytes()
+}
+
+// ParseChallenge parses a challenge serialized by Bytes. Anything but the
+// canonical form is rejected.
+func ParseChallenge(b []byte) (*Challenge, error) {
+	lines := strings.Split(string(b), "\n")
+	if len(lines) != 7 || lines[0] != challengeVersion || lines[6] != "" {
+		return nil, fmt.Errorf("%w: malformed", ErrInvalidChallenge)
+	}
+
+	values := map[string]string{}
+	for i, k := range []string{"nonce", "user", "aud", "iat", "exp"} {
+		v := strings.TrimPrefix(lines[i+1], k+"=")
+		if v == lines[i+1] {
+			return nil, fmt.Errorf("%w: missing %s", ErrInvalidChallenge, k)
+		}
+		values[k] = v
+	}
+
+	iat, err := strconv.ParseInt(values["iat"], 10, 64)
+	if err != nil {
+		return nil, fmt.Errorf("%w: invalid iat", ErrInvalidChallenge)
+	}
+
+	exp, err := strconv.ParseInt(values["exp"], 10, 64)
+	if err != nil {
+		return nil, fmt.Errorf("%w: invalid exp", ErrInvalidChallenge)
+	}
+
+	c := &Challenge{
+		Nonce:     values["nonce"],
+		User:      values["user"],
+		Audience:  values["aud"],
+		IssuedAt:  time.Unix(iat, 0),
+		ExpiresAt: time.Unix(exp, 0),
+	}
+	if err := c.validate(); err != nil {
+		return nil, err
+	}
+
+	if !bytes.Equal(c.Bytes(), b) {
+		return nil, fmt.Errorf("%w: not canonical", ErrInvalidChallenge)
+	}
+	return c, nil
+}
+
+func (c *Challenge) validate() error {
+	if _, err := base64.RawURLEncoding.DecodeString(c.Nonce); err != nil || c.Nonce == "" {
+		return fmt.Errorf("%w: invalid nonce", ErrInvalidChallenge)
+	}
+
+	if err := ValidateName(c.User); err != nil {
+		return fmt.Errorf("%w: %s", ErrInvalidChallenge, err.Error())
+	}
+
+	if err := validateAudience(c.Audience); err != nil {
+		return err
+	}
+
+	if !c.ExpiresAt.After(c.IssuedAt) {
+		return fmt.Errorf("%w: exp is not after iat", ErrInvalidChallenge)
+	}
+	return nil
+}
+
+func validateAudience(audience string) error {
+	if audience == "" || len(audience) > maxAudienceLength {
+		return fmt.Errorf("%w: invalid audience", ErrInvalidChallenge)
+	}
+
+	for _, r := range audience {
+		if r < 0x20 || r == 0x7f {
+			return fmt.Errorf("%w: invalid audience", ErrInvalidChallenge)
+		}
+	}
+	return nil
+}
+
+// CreateUserChallenge issues a challenge for the user valid for audience
+// within Options.ChallengeTTL. It is stored like a challenge code, so it can
+// be verified only once.
+func (s *STNS) CreateUserChallenge(name, audience string) (*Challenge, error) {
+	nonce := make([]byte, 32)
+	if _, err := rand.Read(nonce); err != nil {
+		return nil, errors.New("rand read error")
+	}
+
+	now := time.Now()
+	c := &Challenge{
+		Nonce:     base64.RawURLEncoding.EncodeToString(nonce),
+		User:      name,
+		Audience:  audience,
+		IssuedAt:  now,
+		ExpiresAt: now.Add(s.challengeTTL()),
+	}
+	if err := c.validate(); err != nil {
+		return nil, err
+	}
+
+	if err := s.challenges().Put(name, encodeChallenge(c.Bytes(), c.ExpiresAt), s.challengeTTL()); err != nil {
+		return nil, err
+	}
+	return c, nil
+}
+
+func (s *STNS) VerifyChallenge(name, audience string, msg, signature []byte) (*Challenge, error) {
+	return s.VerifyChallengeContext(context.Background(), name, audience, msg, signature)
+}
+
+// VerifyChallengeContext verifies that msg is a challenge issued by
+// CreateUserChallenge to name for audience, that it is within its time
+// window, and that signature over it was made by one of the user's keys.
+// The outstanding challenge is consumed once msg passes the field checks,
+// even if the signature does not verify.
+func (s *STNS) VerifyChallengeContext(ctx context.Context, name, audience string, msg, signature []byte) (*Challenge, error) {
+	c, err := ParseChallenge(msg)
+	if err != nil {
+		return nil, err
+	}
+
+	if c.User != name {
+		return nil, fmt.Errorf("%w: issued for another user", ErrInvalidChallenge)
+	}
+
+	if c.Audience != audience {
+		return nil, fmt.Errorf("%w: issued for another audience", ErrInvalidChallenge)
+	}
+
+	now := time.Now()
+	if c.IssuedAt.After(now.Add(time.Duration(DefaultChallengeClockSkew) * time.Second)) {
+		return nil, fmt.Errorf("%w: issued in the future", ErrInvalidChallenge)
+	}
+
+	if !now.Before(c.ExpiresAt) {
+		return nil, ErrChallengeExpired
+	}
+
+	if err := s.TakeUserChallengeCode(name, msg); err != nil {
+		if errors.Is(err, ErrChallengeMismatch) {
+			return nil, fmt.Errorf("%w: not the outstanding challenge", ErrInvalidChallenge)
+		}
+		return nil, err
+	}
+
+	if err := s.VerifyWithUserContext(ctx, name, msg, signature); err != nil {
+		return nil, err
+	}
+	return c, nil
+}
@@ -0,0 +1,163 @@
+package libstns
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/STNS/STNS/v2/model"
+	"golang.org/x/crypto/ssh"
+)
+
+func TestParseChallenge(t *testing.T) {
+	c := &Challenge{
+		Nonce:     "bm9uY2U",
+		User:      "alice",
+		Audience:  "ssh.example.com",
+		IssuedAt:  time.Unix(1700000000, 0),
+		ExpiresAt: time.Unix(1700000300, 0),
+	}
+	want := "stns-challenge-v1\nnonce=bm9uY2U\nuser=alice\naud=ssh.example.com\niat=1700000000\nexp=1700000300\n"
+	if string(c.Bytes()) != want {
+		t.Fatalf("Challenge.Bytes() = %q, want %q", c.Bytes(), want)
+	}
+
+	got, err := ParseChallenge([]byte(want))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(got.Bytes()) != want {
+		t.Errorf("ParseChallenge() = %q, want %q", got.Bytes(), want)
+	}
+
+	tests := []string{
+		"",
+		strings.Replace(want, "v1", "v2", 1),
+		strings.Replace(want, "iat=1700000000", "iat=01700000000", 1),
+		strings.Replace(want, "user=alice", "user=alice\nuser=bob", 1),
+		strings.Replace(want, "nonce=bm9uY2U", "nonce=", 1),
+		strings.Replace(want, "nonce=bm9uY2U", "nonce=bm9u+Y2U", 1),
+		strings.Replace(want, "aud=ssh.example.com", "aud=", 1),
+		strings.Replace(want, "exp=1700000300", "exp=1700000000", 1),
+		strings.TrimSuffix(want, "\n"),
+		want + "\n",
+	}
+	for _, tt := range tests {
+		if _, err := ParseChallenge([]byte(tt)); !errors.Is(err, ErrInvalidChallenge) {
+			t.Errorf("ParseChallenge(%q) error = %v, want %v", tt, err, ErrInvalidChallenge)
+		}
+	}
+}
+
+func TestSTNS_VerifyChallenge(t *testing.T) {
+	signer := newTestSigner(t)
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		users := []*model.User{}
+		if r.FormValue("name") == "alice" {
+			users = append(users, &model.User{
+				Base: model.Base{ID: 1, Name: "alice"},
+				Keys: []string{strings.TrimSpace(string(ssh.MarshalAuthorizedKey(signer.PublicKey())))},
+			})
+		}
+		rp, err := json.Marshal(users)
+		if err != nil {
+			t.Error(err)
+		}
+		fmt.Fprint(w, string(rp))
+	}))
+	defer ts.Close()
+
+	s, err := NewSTNS(ts.URL, &Options{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	s.SetChallengeStore(newTestChallengeStore())
+	s.SetSigner(signer)
+
+	tests := []struct {
+		name     string
+		user     string
+		audience string
+		tamper   func(c *Challenge)
+		wantErr  error
+	}{
+		{
+			name:     "ok",
+			user:     "alice",
+			audience: "ssh.example.com",
+		},
+		{
+			name:     "other audience",
+			user:     "alice",
+			audience: "web.example.com",
+			wantErr:  ErrInvalidChallenge,
+		},
+		{
+			name:     "other user",
+			user:     "bob",
+			audience: "ssh.example.com",
+			wantErr:  ErrInvalidChallenge,
+		},
+		{
+			name:     "expired",
+			user:     "alice",
+			audience: "ssh.example.com",
+			tamper: func(c *Challenge) {
+				c.IssuedAt = c.IssuedAt.Add(-time.Hour)
+				c.ExpiresAt = c.ExpiresAt.Add(-time.Hour)
+			},
+			wantErr: ErrChallengeExpired,
+		},
+		{
+			name:     "extended",
+			user:     "alice",
+			audience: "ssh.example.com",
+			tamper: func(c *Challenge) {
+				c.ExpiresAt = c.ExpiresAt.Add(time.Hour)
+			},
+			wantErr: ErrInvalidChallenge,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c, err := s.CreateUserChallenge("alice", "ssh.example.com")
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if tt.tamper != nil {
+				tt.tamper(c)
+			}
+
+			msg := c.Bytes()
+			sig, err := s.Sign(msg)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			got, err := s.VerifyChallenge(tt.user, tt.audience, msg, sig)
+			if tt.wantErr != nil {
+				if !errors.Is(err, tt.wantErr) {
+					t.Errorf("STNS.VerifyChallenge() error = %v, want %v", err, tt.wantErr)
+				}
+				return
+			}
+
+			if err != nil {
+				t.Fatalf("STNS.VerifyChallenge() error = %v", err)
+			}
+			if got.Nonce != c.Nonce {
+				t.Errorf("STNS.VerifyChallenge() nonce = %s, want %s", got.Nonce, c.Nonce)
+			}
+
+			if _, err := s.VerifyChallenge(tt.user, tt.audience, msg, sig); !errors.Is(err, ErrChallengeNotFound) {
+				t.Errorf("STNS.VerifyChallenge() replay error = %v, want %v", err, ErrChallengeNotFound)
+			}
+		})
+	}
+}
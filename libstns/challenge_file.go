@@ -0,0 +1,188 @@
+package libstns
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+// FileChallengeStore stores challenge codes as files in an owner-only
+// directory. File names are the SHA-256 of the user name, so user input
+// never becomes part of a path.
+type FileChallengeStore struct {
+	dir string
+}
+
+func DefaultChallengeDir() string {
+	return filepath.Join(os.TempDir(), fmt.Sprintf("libstns-challenge-%d", os.Getuid()))
+}
+
+// NewFileChallengeStore returns a store that keeps codes in dir, or in
+// DefaultChallengeDir when dir is empty. The directory is created on first
+// use.
+func NewFileChallengeStore(dir string) *FileChallengeStore {
+	if dir == "" {
+		dir = DefaultChallengeDir()
+	}
+	return &FileChallengeStore{dir: dir}
+}
+
+// Put stores code for user, replacing the previous one. It also removes
+// expired codes left behind by users who never took them.
+func (f *FileChallengeStore) Put(user string, code []byte, _ time.Duration) error {
+	if err := f.prepareDir(); err != nil {
+		return err
+	}
+	f.sweep(time.Now())
+
+	tmp, err := ioutil.TempFile(f.dir, ".put-")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+
+	if _, err := tmp.Write(code); err != nil {
+		tmp.Close()
+		return err
+	}
+
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+
+	return os.Rename(tmp.Name(), f.path(user))
+}
+
+// Take renames the code file to a unique name before reading it, so that
+// only one of several concurrent callers gets the code.
+func (f *FileChallengeStore) Take(user string) ([]byte, error) {
+	if err := f.prepareDir(); err != nil {
+		return nil, err
+	}
+
+	suffix := make([]byte, 8)
+	if _, err := rand.Read(suffix); err != nil {
+		return nil, err
+	}
+
+	taken := fmt.Sprintf("%s.take-%s", f.path(user), hex.EncodeToString(suffix))
+	if err := os.Rename(f.path(user), taken); err != nil {
+		if os.IsNotExist(err) {
+			return nil, ErrChallengeNotFound
+		}
+		return nil, err
+	}
+	defer os.Remove(taken)
+
+	fi, err := os.Lstat(taken)
+	if err != nil {
+		return nil, err
+	}
+
+	if !fi.Mode().IsRegular() {
+		return nil, fmt.Errorf("challenge code is not a regular file path:%s", taken)
+	}
+
+	fp, err := openNoFollow(taken)
+	if err != nil {
+		return nil, err
+	}
+	defer fp.Close()
+
+	return ioutil.ReadAll(fp)
+}
+
+// sweep removes the codes that expired before now. Files that do not hold
+// a code with an expiry, such as ones being written or taken, are left
+// alone.
+func (f *FileChallengeStore) sweep(now time.Time) {
+	files, err := ioutil.ReadDir(f.dir)
+	if err != nil {
+		logrus.Warnf("read challenge directory error:%s", err.Error())
+		return
+	}
+
+	for _, fi := range files {
+		if !fi.Mode().IsRegular() || strings.Contains(fi.Name(), ".") {
+			continue
+		}
+
+		p := filepath.Join(f.dir, fi.Name())
+		if !expiredChallengeFile(p, now) {
+			continue
+		}
+
+		if err := os.Remove(p); err != nil && !os.IsNotExist(err) {
+			logrus.Warnf("remove challenge code error:%s", err.Error())
+		}
+	}
+}
+
+// expiredChallengeFile reports whether the file at p holds an expired code
+// and has not been replaced by a fresh one while it was read.
+func expiredChallengeFile(p string, now time.Time) bool {
+	fp, err := openNoFollow(p)
+	if err != nil {
+		return false
+	}
+	defer fp.Close()
+
+	b, err := ioutil.ReadAll(io.LimitReader(fp, 64))
+	if err != nil {
+		return false
+	}
+
+	if _, err := decodeChallenge(b, now); !errors.Is(err, ErrChallengeExpired) {
+		return false
+	}
+
+	opened, err := fp.Stat()
+	if err != nil {
+		return false
+	}
+
+	current, err := os.Lstat(p)
+	return err == nil && os.SameFile(opened, current)
+}
+
+func (f *FileChallengeStore) path(user string) string {
+	sum := sha256.Sum256([]byte(user))
+	return filepath.Join(f.dir, hex.EncodeToString(sum[:]))
+}
+
+// prepareDir creates the directory if needed and refuses to use it unless
+// it is a real directory that checkDirAccess accepts.
+func (f *FileChallengeStore) prepareDir() error {
+	if err := os.Mkdir(f.dir, 0700); err != nil && !os.IsExist(err) {
+		return err
+	}
+
+	fi, err := os.Lstat(f.dir)
+	if err != nil {
+		return err
+	}
+
+	if fi.Mode()&os.ModeSymlink != 0 || !fi.IsDir() {
+		return fmt.Errorf("challenge directory is not a directory path:%s", f.dir)
+	}
+
+	return checkDirAccess(fi, f.dir)
+}
+
+func DefaultStoreChallengeCode(user string, code []byte) error {
+	return NewFileChallengeStore("").Put(user, code, 0)
+}
+
+func DefaultPopChallengeCode(user string) ([]byte, error) {
+	return NewFileChallengeStore("").Take(user)
+}
@@ -0,0 +1,160 @@
+package libstns
+
+import (
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestFileChallengeStore(t *testing.T) {
+	dir := filepath.Join(t.TempDir(), "challenge")
+	f := NewFileChallengeStore(dir)
+
+	if err := f.Put("../../etc/foo", []byte("code"), 0); err != nil {
+		t.Fatal(err)
+	}
+
+	fi, err := os.Stat(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if fi.Mode().Perm() != 0700 {
+		t.Errorf("challenge directory mode = %o, want 0700", fi.Mode().Perm())
+	}
+
+	files, err := ioutil.ReadDir(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(files) != 1 || files[0].Name() != filepath.Base(f.path("../../etc/foo")) || files[0].Mode().Perm() != 0600 {
+		t.Errorf("challenge directory files = %v", files)
+	}
+
+	got, err := f.Take("../../etc/foo")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(got) != "code" {
+		t.Errorf("FileChallengeStore.Take() = %s, want %s", got, "code")
+	}
+
+	if _, err := f.Take("../../etc/foo"); !errors.Is(err, ErrChallengeNotFound) {
+		t.Errorf("FileChallengeStore.Take() error = %v, want %v", err, ErrChallengeNotFound)
+	}
+}
+
+func TestFileChallengeStore_Symlink(t *testing.T) {
+	base := t.TempDir()
+	dir := filepath.Join(base, "challenge")
+	f := NewFileChallengeStore(dir)
+	if err := f.Put("example", []byte("code"), 0); err != nil {
+		t.Fatal(err)
+	}
+
+	target := filepath.Join(base, "target")
+	if err := ioutil.WriteFile(target, []byte("secret"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Remove(f.path("example")); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Symlink(target, f.path("example")); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := f.Take("example"); err == nil {
+		t.Error("FileChallengeStore.Take() error = nil, want error")
+	}
+
+	if err := os.Symlink(target, f.path("example")); err != nil {
+		t.Fatal(err)
+	}
+	if err := f.Put("example", []byte("code"), 0); err != nil {
+		t.Fatal(err)
+	}
+	if b, err := ioutil.ReadFile(target); err != nil || string(b) != "secret" {
+		t.Errorf("symlink target = %s, %v; want untouched", b, err)
+	}
+}
+
+func TestSTNS_ChallengeDir(t *testing.T) {
+	dir := filepath.Join(t.TempDir(), "challenge")
+	s, err := NewSTNS("http://localhost", &Options{ChallengeDir: dir})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	code, err := s.CreateUserChallengeCode("example")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(NewFileChallengeStore(dir).path("example")); err != nil {
+		t.Fatal(err)
+	}
+
+	got, err := s.PopUserChallengeCode("example")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(got) != string(code) {
+		t.Errorf("STNS.PopUserChallengeCode() = %s, want %s", got, code)
+	}
+}
+
+func TestFileChallengeStore_Sweep(t *testing.T) {
+	dir := filepath.Join(t.TempDir(), "challenge")
+	f := NewFileChallengeStore(dir)
+
+	now := time.Now()
+	if err := f.Put("expired", encodeChallenge([]byte("code"), now.Add(-time.Second)), 0); err != nil {
+		t.Fatal(err)
+	}
+	if err := f.Put("opaque", []byte("code"), 0); err != nil {
+		t.Fatal(err)
+	}
+	if err := f.Put("fresh", encodeChallenge([]byte("code"), now.Add(time.Minute)), 0); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := os.Stat(f.path("expired")); !os.IsNotExist(err) {
+		t.Errorf("expired code error = %v, want removed", err)
+	}
+	for _, user := range []string{"opaque", "fresh"} {
+		if _, err := os.Stat(f.path(user)); err != nil {
+			t.Errorf("%s code error = %v, want kept", user, err)
+		}
+	}
+}
+
+func TestSTNS_ChallengeDirFallback(t *testing.T) {
+	dir := filepath.Join(t.TempDir(), "challenge")
+	s, err := NewSTNS("http://localhost", &Options{ChallengeDir: dir})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var popped bool
+	s.SetPopChallengeCode(func(user string) ([]byte, error) {
+		popped = true
+		return NewFileChallengeStore(dir).Take(user)
+	})
+
+	code, err := s.CreateUserChallengeCode("example")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(NewFileChallengeStore(dir).path("example")); err != nil {
+		t.Fatal(err)
+	}
+
+	got, err := s.PopUserChallengeCode("example")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !popped || string(got) != string(code) {
+		t.Errorf("STNS.PopUserChallengeCode() = %s, want %s from the pop function", got, code)
+	}
+}
@@ -0,0 +1,31 @@
+//go:build !windows
+
+package libstns
+
+import (
+	"fmt"
+	"os"
+	"syscall"
+)
+
+// checkDirAccess refuses a directory that is accessible by other users or
+// owned by another user.
+func checkDirAccess(fi os.FileInfo, path string) error {
+	if fi.Mode().Perm()&0077 != 0 {
+		return fmt.Errorf("challenge directory is accessible by others path:%s mode:%o", path, fi.Mode().Perm())
+	}
+
+	st, ok := fi.Sys().(*syscall.Stat_t)
+	if !ok {
+		return nil
+	}
+
+	if int(st.Uid) != os.Getuid() {
+		return fmt.Errorf("challenge directory is owned by another user path:%s uid:%d", path, st.Uid)
+	}
+	return nil
+}
+
+func openNoFollow(path string) (*os.File, error) {
+	return os.OpenFile(path, os.O_RDONLY|syscall.O_NOFOLLOW, 0)
+}
@@ -0,0 +1,36 @@
+//go:build !windows
+
+package libstns
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestFileChallengeStore_UnsafeDir(t *testing.T) {
+	base := t.TempDir()
+
+	open := filepath.Join(base, "open")
+	if err := os.Mkdir(open, 0777); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Chmod(open, 0777); err != nil {
+		t.Fatal(err)
+	}
+
+	real := filepath.Join(base, "real")
+	if err := os.Mkdir(real, 0700); err != nil {
+		t.Fatal(err)
+	}
+	link := filepath.Join(base, "link")
+	if err := os.Symlink(real, link); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, dir := range []string{open, link} {
+		if err := NewFileChallengeStore(dir).Put("example", []byte("code"), 0); err == nil {
+			t.Errorf("FileChallengeStore.Put() dir = %s error = nil, want error", dir)
+		}
+	}
+}
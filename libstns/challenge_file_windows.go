@@ -0,0 +1,13 @@
+package libstns
+
+import "os"
+
+// checkDirAccess is a no-op on Windows, where permission bits do not
+// reflect the directory ACL.
+func checkDirAccess(fi os.FileInfo, path string) error {
+	return nil
+}
+
+func openNoFollow(path string) (*os.File, error) {
+	return os.Open(path)
+}
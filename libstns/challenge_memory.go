@@ -0,0 +1,204 @@
+package libstns
+
+import (
+	"sync"
+	"time"
+)
+
+var DefaultChallengeJanitorInterval = 60
+var DefaultMaxChallengesPerUser = 5
+
+type MemoryChallengeStoreOptions struct {
+	// JanitorInterval is how often expired codes are swept, in seconds.
+	// A negative value disables the janitor.
+	JanitorInterval int
+	// MaxPerUser caps the outstanding codes per user. The oldest code is
+	// evicted when a new one would exceed it. Any outstanding code can be
+	// redeemed with TakeMatch, which STNS.TakeUserChallengeCode uses, while
+	// Take returns only the newest code and discards the rest.
+	MaxPerUser int
+}
+
+type ChallengeStats struct {
+	Issued      uint64
+	Consumed    uint64
+	Expired     uint64
+	Evicted     uint64
+	Outstanding int
+}
+
+type memoryChallenge struct {
+	code   []byte
+	expire time.Time
+}
+
+// MemoryChallengeStore is a goroutine-safe ChallengeStore for single
+// process servers. It keeps up to MaxPerUser outstanding codes per user,
+// so a user can hold several challenges at once, and implements
+// MatchingChallengeStore to redeem any of them.
+type MemoryChallengeStore struct {
+	mu         sync.Mutex
+	codes      map[string][]*memoryChallenge
+	maxPerUser int
+	stats      ChallengeStats
+	stop       chan struct{}
+	stopOnce   sync.Once
+}
+
+func NewMemoryChallengeStore(opt *MemoryChallengeStoreOptions) *MemoryChallengeStore {
+	if opt == nil {
+		opt = &MemoryChallengeStoreOptions{}
+	}
+
+	if opt.JanitorInterval == 0 {
+		opt.JanitorInterval = DefaultChallengeJanitorInterval
+	}
+
+	if opt.MaxPerUser == 0 {
+		opt.MaxPerUser = DefaultMaxChallengesPerUser
+	}
+
+	m := &MemoryChallengeStore{
+		codes:      map[string][]*memoryChallenge{},
+		maxPerUser: opt.MaxPerUser,
+		stop:       make(chan struct{}),
+	}
+
+	if opt.JanitorInterval > 0 {
+		go m.janitor(time.Duration(opt.JanitorInterval) * time.Second)
+	}
+	return m
+}
+
+func (m *MemoryChallengeStore) Put(user string, code []byte, ttl time.Duration) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	now := time.Now()
+	cs := append(m.unexpired(user, now), &memoryChallenge{
+		code:   code,
+		expire: now.Add(ttl),
+	})
+
+	if over := len(cs) - m.maxPerUser; over > 0 {
+		m.stats.Evicted += uint64(over)
+		cs = cs[over:]
+	}
+
+	m.codes[user] = cs
+	m.stats.Issued++
+	return nil
+}
+
+func (m *MemoryChallengeStore) Take(user string) ([]byte, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	cs := m.unexpired(user, time.Now())
+	if len(cs) == 0 {
+		delete(m.codes, user)
+		return nil, ErrChallengeNotFound
+	}
+
+	// Older codes are discarded so that none of them can be taken after a
+	// newer one was.
+	c := cs[len(cs)-1]
+	delete(m.codes, user)
+
+	m.stats.Evicted += uint64(len(cs) - 1)
+	m.stats.Consumed++
+	return c.code, nil
+}
+
+// TakeMatch removes and returns the newest unexpired code of user for
+// which match returns true. The other codes stay outstanding.
+func (m *MemoryChallengeStore) TakeMatch(user string, match func([]byte) bool) ([]byte, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	cs := m.unexpired(user, time.Now())
+	for i := len(cs) - 1; i >= 0; i-- {
+		if !match(cs[i].code) {
+			continue
+		}
+
+		c := cs[i]
+		if rest := append(cs[:i], cs[i+1:]...); len(rest) > 0 {
+			m.codes[user] = rest
+		} else {
+			delete(m.codes, user)
+		}
+
+		m.stats.Consumed++
+		return c.code, nil
+	}
+
+	if len(cs) == 0 {
+		delete(m.codes, user)
+	} else {
+		m.codes[user] = cs
+	}
+	return nil, ErrChallengeNotFound
+}
+
+func (m *MemoryChallengeStore) Stats() ChallengeStats {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	st := m.stats
+	for _, cs := range m.codes {
+		st.Outstanding += len(cs)
+	}
+	return st
+}
+
+// Close stops the janitor.
+func (m *MemoryChallengeStore) Close() error {
+	m.stopOnce.Do(func() {
+		close(m.stop)
+	})
+	return nil
+}
+
+// unexpired drops the expired codes of user and returns the rest, oldest
+// first. It must be called with m.mu held.
+func (m *MemoryChallengeStore) unexpired(user string, now time.Time) []*memoryChallenge {
+	cs := m.codes[user]
+	ret := cs[:0]
+	for _, c := range cs {
+		if now.Before(c.expire) {
+			ret = append(ret, c)
+			continue
+		}
+		m.stats.Expired++
+	}
+	return ret
+}
+
+func (m *MemoryChallengeStore) sweep() {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	now := time.Now()
+	for user := range m.codes {
+		if cs := m.unexpired(user, now); len(cs) > 0 {
+			m.codes[user] = cs
+		} else {
+			delete(m.codes, user)
+		}
+	}
+}
+
+func (m *MemoryChallengeStore) janitor(interval time.Duration) {
+	t := time.NewTicker(interval)
+	defer t.Stop()
+
+	for {
+		select {
+		case <-t.C:
+			m.sweep()
+		case <-m.stop:
+			return
+		}
+	}
+}
@@ -0,0 +1,134 @@
+package libstns
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestMemoryChallengeStore(t *testing.T) {
+	m := NewMemoryChallengeStore(&MemoryChallengeStoreOptions{MaxPerUser: 2, JanitorInterval: -1})
+	defer m.Close()
+
+	for i := 1; i <= 3; i++ {
+		if err := m.Put("example", []byte(fmt.Sprintf("code%d", i)), time.Minute); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	got, err := m.Take("example")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(got) != "code3" {
+		t.Errorf("MemoryChallengeStore.Take() = %s, want %s", got, "code3")
+	}
+
+	// the older code2 is discarded along with code3
+
+	if _, err := m.Take("example"); !errors.Is(err, ErrChallengeNotFound) {
+		t.Errorf("MemoryChallengeStore.Take() error = %v, want %v", err, ErrChallengeNotFound)
+	}
+
+	if err := m.Put("example", []byte("expired"), -time.Second); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := m.Take("example"); !errors.Is(err, ErrChallengeNotFound) {
+		t.Errorf("MemoryChallengeStore.Take() error = %v, want %v", err, ErrChallengeNotFound)
+	}
+
+	want := ChallengeStats{Issued: 4, Consumed: 1, Expired: 1, Evicted: 2}
+	if got := m.Stats(); got != want {
+		t.Errorf("MemoryChallengeStore.Stats() = %+v, want %+v", got, want)
+	}
+}
+
+func TestMemoryChallengeStore_Janitor(t *testing.T) {
+	m := NewMemoryChallengeStore(&MemoryChallengeStoreOptions{JanitorInterval: -1})
+	defer m.Close()
+
+	if err := m.Put("example1", []byte("code"), time.Millisecond); err != nil {
+		t.Fatal(err)
+	}
+	if err := m.Put("example2", []byte("code"), time.Minute); err != nil {
+		t.Fatal(err)
+	}
+	time.Sleep(5 * time.Millisecond)
+	m.sweep()
+
+	if st := m.Stats(); st.Expired != 1 || st.Outstanding != 1 {
+		t.Errorf("MemoryChallengeStore.Stats() = %+v", st)
+	}
+}
+
+func TestMemoryChallengeStore_Concurrent(t *testing.T) {
+	m := NewMemoryChallengeStore(nil)
+	defer m.Close()
+
+	if err := m.Put("example", []byte("code"), time.Minute); err != nil {
+		t.Fatal(err)
+	}
+
+	var wg sync.WaitGroup
+	var mu sync.Mutex
+	taken := 0
+	for i := 0; i < 16; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if _, err := m.Take("example"); err == nil {
+				mu.Lock()
+				taken++
+				mu.Unlock()
+			}
+		}()
+	}
+	wg.Wait()
+
+	if taken != 1 {
+		t.Errorf("taken = %d, want 1", taken)
+	}
+}
+
+func TestMemoryChallengeStore_TakeMatch(t *testing.T) {
+	m := NewMemoryChallengeStore(&MemoryChallengeStoreOptions{MaxPerUser: 2, JanitorInterval: -1})
+	defer m.Close()
+
+	for i := 1; i <= 3; i++ {
+		if err := m.Put("example", []byte(fmt.Sprintf("code%d", i)), time.Minute); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	match := func(want string) func([]byte) bool {
+		return func(code []byte) bool {
+			return string(code) == want
+		}
+	}
+
+	// code1 was evicted by MaxPerUser
+	if _, err := m.TakeMatch("example", match("code1")); !errors.Is(err, ErrChallengeNotFound) {
+		t.Errorf("MemoryChallengeStore.TakeMatch() error = %v, want %v", err, ErrChallengeNotFound)
+	}
+
+	for _, want := range []string{"code2", "code3"} {
+		got, err := m.TakeMatch("example", match(want))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(got) != want {
+			t.Errorf("MemoryChallengeStore.TakeMatch() = %s, want %s", got, want)
+		}
+	}
+
+	if _, err := m.TakeMatch("example", match("code2")); !errors.Is(err, ErrChallengeNotFound) {
+		t.Errorf("MemoryChallengeStore.TakeMatch() error = %v, want %v", err, ErrChallengeNotFound)
+	}
+
+	want := ChallengeStats{Issued: 3, Consumed: 2, Evicted: 1}
+	if got := m.Stats(); got != want {
+		t.Errorf("MemoryChallengeStore.Stats() = %+v, want %+v", got, want)
+	}
+}
@@ -0,0 +1,151 @@
+package libstns
+
+import (
+	"errors"
+	"reflect"
+	"sync"
+	"testing"
+	"time"
+)
+
+type testChallengeStore struct {
+	mu    sync.Mutex
+	codes map[string][]byte
+	ttls  map[string]time.Duration
+}
+
+func newTestChallengeStore() *testChallengeStore {
+	return &testChallengeStore{
+		codes: map[string][]byte{},
+		ttls:  map[string]time.Duration{},
+	}
+}
+
+func (s *testChallengeStore) Put(user string, code []byte, ttl time.Duration) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.codes[user] = code
+	s.ttls[user] = ttl
+	return nil
+}
+
+func (s *testChallengeStore) Take(user string) ([]byte, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	code, ok := s.codes[user]
+	if !ok {
+		return nil, ErrChallengeNotFound
+	}
+	delete(s.codes, user)
+	return code, nil
+}
+
+func TestSTNS_ChallengeStore(t *testing.T) {
+	store := newTestChallengeStore()
+	s := &STNS{
+		opt:               &Options{ChallengeTTL: 60},
+		makeChallengeCode: DefaultMakeChallengeCode,
+	}
+	s.SetChallengeStore(store)
+
+	code, err := s.CreateUserChallengeCode("example")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if store.ttls["example"] != time.Minute {
+		t.Errorf("ChallengeStore.Put() ttl = %v, want %v", store.ttls["example"], time.Minute)
+	}
+
+	got, err := s.PopUserChallengeCode("example")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(got, code) {
+		t.Errorf("STNS.PopUserChallengeCode() = %s, want %s", got, code)
+	}
+
+	if _, err := s.PopUserChallengeCode("example"); !errors.Is(err, ErrChallengeNotFound) {
+		t.Errorf("STNS.PopUserChallengeCode() error = %v, want %v", err, ErrChallengeNotFound)
+	}
+
+	store.codes["example"] = encodeChallenge([]byte("expired"), time.Now().Add(-time.Second))
+	if _, err := s.PopUserChallengeCode("example"); !errors.Is(err, ErrChallengeExpired) {
+		t.Errorf("STNS.PopUserChallengeCode() error = %v, want %v", err, ErrChallengeExpired)
+	}
+}
+
+func TestSTNS_ChallengeFuncAdapters(t *testing.T) {
+	stored := map[string][]byte{}
+	s := &STNS{
+		makeChallengeCode: func() ([]byte, error) {
+			return []byte("dummy"), nil
+		},
+	}
+	s.SetChallengeStore(newTestChallengeStore())
+	s.SetStoreChallengeCode(func(user string, code []byte) error {
+		stored[user] = code
+		return nil
+	})
+	s.SetPopChallengeCode(func(user string) ([]byte, error) {
+		code := stored[user]
+		delete(stored, user)
+		return code, nil
+	})
+
+	if _, err := s.CreateUserChallengeCode("example"); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := stored["example"]; !ok {
+		t.Fatal("store function was not called")
+	}
+
+	got, err := s.PopUserChallengeCode("example")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(got) != "dummy" {
+		t.Errorf("STNS.PopUserChallengeCode() = %s, want %s", got, "dummy")
+	}
+}
+
+func Test_decodeChallenge(t *testing.T) {
+	now := time.Now()
+	tests := []struct {
+		name    string
+		b       []byte
+		want    []byte
+		wantErr error
+	}{
+		{
+			name: "ok",
+			b:    encodeChallenge([]byte("code"), now.Add(time.Second)),
+			want: []byte("code"),
+		},
+		{
+			name:    "expired",
+			b:       encodeChallenge([]byte("code"), now),
+			wantErr: ErrChallengeExpired,
+		},
+		{
+			name:    "without expiry",
+			b:       []byte("code"),
+			wantErr: ErrChallengeNotFound,
+		},
+		{
+			name:    "broken expiry",
+			b:       []byte("abc:code"),
+			wantErr: ErrChallengeNotFound,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := decodeChallenge(tt.b, now)
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("decodeChallenge() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("decodeChallenge() = %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
@@ -4,6 +4,7 @@ import (
 	"context"
 	"crypto/tls"
 	"crypto/x509"
+	"errors"
 	"fmt"
 	"io/ioutil"
 	"net"
@@ -33,20 +34,39 @@ var DefaultRetry = 3
 type client struct {
 	ApiEndpoint string
 	opt         *Options
-	httpClient  *http.Client
+	endpoints   []*endpoint
+	next        uint32
+	stale       *staleStore
+	validators  *validatorStore
 }
 
 type Response struct {
 	StatusCode int
 	Headers    map[string]string
 	Body       []byte
+	// Endpoint is the configured endpoint that answered the request.
+	Endpoint string
+	// Stale is set when the server was unreachable and the last good
+	// response was served instead.
+	Stale bool
+	// NotModified is set when the server answered 304 to a conditional
+	// request and Body holds the previously fetched content.
+	NotModified bool
 }
 
 func newClient(endpoint string, opt *Options) (*client, error) {
+	return newClientWithEndpoints([]string{endpoint}, opt)
+}
+
+func newClientWithEndpoints(endpoints []string, opt *Options) (*client, error) {
 	if err := env.Parse(opt); err != nil {
 		return nil, err
 	}
 
+	if len(endpoints) == 0 {
+		return nil, errors.New("no endpoint specified")
+	}
+
 	if opt.PrivatekeyPath == "" {
 		opt.PrivatekeyPath = "~/.ssh/id_rsa"
 	}
@@ -63,22 +83,67 @@ func newClient(endpoint string, opt *Options) (*client, error) {
 		opt.RequestRetry = DefaultRetry
 	}
 
-	retryclient := retryablehttp.NewClient()
-	retryclient.RetryMax = opt.RequestRetry
+	if opt.EndpointPolicy == "" {
+		opt.EndpointPolicy = EndpointPolicyPrimary
+	}
+
+	if opt.EndpointBackoff == 0 {
+		opt.EndpointBackoff = DefaultEndpointBackoff
+	}
+
+	switch opt.EndpointPolicy {
+	case EndpointPolicyPrimary, EndpointPolicyRoundRobin:
+	default:
+		return nil, fmt.Errorf("unknown endpoint policy:%s", opt.EndpointPolicy)
+	}
+
+	// Retrying an endpoint that keeps failing only delays the failover,
+	// so with several endpoints each of them is tried once per request.
+	retry := opt.RequestRetry
+	if len(endpoints) > 1 {
+		retry = 0
+	}
+
+	c := &client{
+		opt: opt,
+	}
+	for _, endpoint := range endpoints {
+		e, err := newEndpoint(endpoint, opt, retry)
+		if err != nil {
+			return nil, err
+		}
+		c.endpoints = append(c.endpoints, e)
+	}
+	c.ApiEndpoint = c.endpoints[0].url
+
+	if opt.StaleIfError {
+		c.stale = newStaleStore(opt)
+	}
 
-	httpClient := retryclient.StandardClient()
+	if opt.ConditionalRequest {
+		c.validators = newValidatorStore(opt)
+	}
+	return c, nil
+}
+
+func newHTTPClient(endpoint string, opt *Options, retry int) (*http.Client, string, error) {
+	retryclient := retryablehttp.NewClient()
+	retryclient.RetryMax = retry
+	retryclient.Logger = nil
+	retryclient.ErrorHandler = retryablehttp.PassthroughErrorHandler
 
+	dialer := &net.Dialer{
+		Timeout: time.Duration(opt.RequestTimeout) * time.Second,
+	}
 	tr := &http.Transport{
-		Dial: (&net.Dialer{
-			Timeout: time.Duration(opt.RequestTimeout) * time.Second,
-		}).Dial,
+		DialContext:       dialer.DialContext,
 		DisableKeepAlives: !opt.HttpKeepalive,
 	}
 	if strings.Index(endpoint, "https") == 0 {
 		tc, err := tlsConfig(opt)
 		if err != nil {
 			logrus.Errorf("make tls config error:%s", err.Error())
-			return nil, err
+			return nil, "", err
 		}
 
 		tr.TLSClientConfig = tc
@@ -88,10 +153,10 @@ func newClient(endpoint string, opt *Options) (*client, error) {
 		u, err := url.Parse(endpoint)
 		if err != nil {
 			logrus.Errorf("unix schema URL parse error:%s", err.Error())
-			return nil, err
+			return nil, "", err
 		}
-		tr.DialContext = func(_ context.Context, _, _ string) (net.Conn, error) {
-			return net.Dial("unix", u.Path)
+		tr.DialContext = func(ctx context.Context, _, _ string) (net.Conn, error) {
+			return dialer.DialContext(ctx, "unix", u.Path)
 		}
 		endpoint = "http://unix"
 	}
@@ -104,15 +169,21 @@ func newClient(endpoint string, opt *Options) (*client, error) {
 		}
 	}
 
-	httpClient.Transport = tr
-	return &client{
-		ApiEndpoint: endpoint,
-		opt:         opt,
-		httpClient:  httpClient,
-	}, nil
+	// The dialer timeout alone does not stop a server that accepts the
+	// connection and never answers, so bound each attempt as a whole.
+	retryclient.HTTPClient = &http.Client{
+		Transport: tr,
+		Timeout:   time.Duration(opt.RequestTimeout) * time.Second,
+	}
+	return retryclient.StandardClient(), endpoint, nil
 }
+
 func (h *client) RequestURL(requestPath, query string) (*url.URL, error) {
-	u, err := url.Parse(h.ApiEndpoint)
+	return requestURL(h.ApiEndpoint, requestPath, query)
+}
+
+func requestURL(endpoint, requestPath, query string) (*url.URL, error) {
+	u, err := url.Parse(endpoint)
 	if err != nil {
 		return nil, err
 	}
@@ -124,6 +195,54 @@ func (h *client) RequestURL(requestPath, query string) (*url.URL, error) {
 }
 
 func (h *client) Request(path, query string) (*Response, error) {
+	return h.RequestContext(context.Background(), path, query)
+}
+
+func (h *client) RequestContext(ctx context.Context, path, query string) (*Response, error) {
+	r, err := h.do(ctx, path, query)
+	if h.stale == nil {
+		return r, err
+	}
+
+	key := path + "?" + query
+	if err == nil {
+		h.stale.store(key, r)
+		return r, nil
+	}
+
+	if isUnavailable(ctx, err) {
+		if sr := h.stale.load(key); sr != nil {
+			logrus.Warnf("serve stale response path:%s query:%s error:%s", path, query, err.Error())
+			markStale(ctx)
+			return sr, nil
+		}
+	}
+	return r, err
+}
+
+func (h *client) do(ctx context.Context, path, query string) (*Response, error) {
+	var r *Response
+	var err error
+	for _, e := range h.candidates() {
+		r, err = h.doEndpoint(ctx, e, path, query)
+		if err != nil && ctx.Err() != nil {
+			// The caller gave up, which says nothing about the endpoint's
+			// health. A hung endpoint is caught by the per-attempt timeout.
+			return r, err
+		}
+
+		if !isUnavailable(ctx, err) {
+			e.markHealthy()
+			return r, err
+		}
+
+		logrus.Warnf("endpoint unavailable endpoint:%s error:%s", e.name, err.Error())
+		e.markUnhealthy(err, time.Duration(h.opt.EndpointBackoff)*time.Second)
+	}
+	return r, err
+}
+
+func (h *client) doEndpoint(ctx context.Context, e *endpoint, path, query string) (*Response, error) {
 	supportHeaders := []string{
 		"user-highest-id",
 		"user-lowest-id",
@@ -131,12 +250,12 @@ func (h *client) Request(path, query string) (*Response, error) {
 		"group-lowest-id",
 	}
 
-	u, err := h.RequestURL(path, query)
+	u, err := requestURL(e.url, path, query)
 	if err != nil {
 		return nil, err
 	}
 
-	req, err := http.NewRequest("GET", u.String(), nil)
+	req, err := http.NewRequestWithContext(ctx, "GET", u.String(), nil)
 	if err != nil {
 		logrus.Errorf("make http request error:%s", err.Error())
 		return nil, err
@@ -144,8 +263,11 @@ func (h *client) Request(path, query string) (*Response, error) {
 
 	h.setHeaders(req)
 	h.setBasicAuth(req)
+	if h.validators != nil {
+		h.validators.setConditionalHeaders(u.String(), req)
+	}
 
-	resp, err := h.httpClient.Do(req)
+	resp, err := e.httpClient.Do(req)
 	if err != nil {
 		logrus.Errorf("http request error:%s", err.Error())
 		return nil, err
@@ -166,13 +288,32 @@ func (h *client) Request(path, query string) (*Response, error) {
 			return nil, err
 		}
 
+		if h.validators != nil {
+			h.validators.store(u.String(), resp, body, headers)
+		}
+
 		r := Response{
 			StatusCode: resp.StatusCode,
 			Body:       body,
 			Headers:    headers,
+			Endpoint:   e.name,
 		}
 
 		return &r, nil
+	case http.StatusNotModified:
+		if h.validators != nil {
+			if body, headers, ok := h.validators.load(u.String(), headers); ok {
+				r := Response{
+					StatusCode:  resp.StatusCode,
+					Body:        body,
+					Headers:     headers,
+					Endpoint:    e.name,
+					NotModified: true,
+				}
+				return &r, nil
+			}
+		}
+		fallthrough
 	default:
 		body, err := ioutil.ReadAll(resp.Body)
 		if err != nil {
@@ -182,9 +323,14 @@ func (h *client) Request(path, query string) (*Response, error) {
 			StatusCode: resp.StatusCode,
 			Body:       body,
 			Headers:    headers,
+			Endpoint:   e.name,
 		}
 
-		return &r, fmt.Errorf("status code=%d, body=%s", resp.StatusCode, string(body))
+		return &r, &HTTPError{
+			StatusCode: resp.StatusCode,
+			Body:       body,
+			URL:        u.String(),
+		}
 	}
 }
 
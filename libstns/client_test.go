@@ -1,12 +1,17 @@
 package libstns
 
 import (
+	"context"
+	"errors"
 	"fmt"
+	"net"
 	"net/http"
 	"net/http/httptest"
 	"os"
+	"path/filepath"
 	"reflect"
 	"testing"
+	"time"
 )
 
 func TestClient_Request(t *testing.T) {
@@ -67,6 +72,7 @@ func TestClient_Request(t *testing.T) {
 				t.Errorf("Client.Request() error = %v, wantErr %v", err, tt.wantErr)
 				return
 			}
+			tt.want.Endpoint = ts.URL
 			if !reflect.DeepEqual(got, tt.want) {
 				t.Errorf("Client.Request() = %v, want %v", got, tt.want)
 			}
@@ -152,3 +158,84 @@ func TestnewClient(t *testing.T) {
 		})
 	}
 }
+
+func TestClient_RequestContext(t *testing.T) {
+	tests := []struct {
+		name    string
+		timeout time.Duration
+		wait    time.Duration
+		wantErr error
+	}{
+		{
+			name:    "ok",
+			timeout: time.Second,
+		},
+		{
+			name:    "deadline exceeded",
+			timeout: 10 * time.Millisecond,
+			wait:    time.Second,
+			wantErr: context.DeadlineExceeded,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				select {
+				case <-time.After(tt.wait):
+				case <-r.Context().Done():
+				}
+				fmt.Fprintf(w, "it is ok")
+			}))
+			defer ts.Close()
+			h, err := newClient(
+				ts.URL,
+				&Options{},
+			)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			ctx, cancel := context.WithTimeout(context.Background(), tt.timeout)
+			defer cancel()
+
+			_, err = h.RequestContext(ctx, "test", "")
+			if !errors.Is(err, tt.wantErr) {
+				t.Errorf("Client.RequestContext() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestClient_RequestContextUnixSocket(t *testing.T) {
+	dir := t.TempDir()
+	sock := filepath.Join(dir, "stns.sock")
+	l, err := net.Listen("unix", sock)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ts := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprintf(w, "it is ok")
+	}))
+	ts.Listener = l
+	ts.Start()
+	defer ts.Close()
+
+	h, err := newClient("unix://"+sock, &Options{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	got, err := h.RequestContext(context.Background(), "test", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(got.Body) != "it is ok" {
+		t.Errorf("Client.RequestContext() body = %s, want %s", got.Body, "it is ok")
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if _, err := h.RequestContext(ctx, "test", ""); !errors.Is(err, context.Canceled) {
+		t.Errorf("Client.RequestContext() error = %v, want %v", err, context.Canceled)
+	}
+}
@@ -0,0 +1,87 @@
+package libstns
+
+import (
+	"net/http"
+	"time"
+)
+
+var DefaultValidatorTTL = 86400
+
+type validatorEntry struct {
+	etag         string
+	lastModified string
+	body         []byte
+	headers      map[string]string
+}
+
+// validatorStore remembers the ETag and Last-Modified validators and the
+// body of the last 200 response per request URL, so that unchanged
+// resources can be revalidated with a conditional GET. It holds at most
+// Options.CacheSize entries, evicting the least recently used.
+type validatorStore struct {
+	entries *cache
+}
+
+func newValidatorStore(opt *Options) *validatorStore {
+	size := opt.CacheSize
+	if size == 0 {
+		size = DefaultCacheSize
+	}
+
+	ttl := time.Duration(DefaultValidatorTTL) * time.Second
+	return &validatorStore{
+		entries: newLRUCache(ttl, ttl, size),
+	}
+}
+
+func (s *validatorStore) setConditionalHeaders(key string, req *http.Request) {
+	v, ok := s.entries.get(key)
+	if !ok {
+		return
+	}
+	e := v.(*validatorEntry)
+
+	if e.etag != "" {
+		req.Header.Set("If-None-Match", e.etag)
+	}
+
+	if e.lastModified != "" {
+		req.Header.Set("If-Modified-Since", e.lastModified)
+	}
+}
+
+func (s *validatorStore) store(key string, resp *http.Response, body []byte, headers map[string]string) {
+	etag := resp.Header.Get("ETag")
+	lastModified := resp.Header.Get("Last-Modified")
+
+	if etag == "" && lastModified == "" {
+		s.entries.delete(key)
+		return
+	}
+
+	s.entries.set(key, &validatorEntry{
+		etag:         etag,
+		lastModified: lastModified,
+		body:         body,
+		headers:      headers,
+	})
+}
+
+// load returns the remembered body and headers for key. Headers sent with
+// the 304 response take precedence over the remembered ones. The entry is
+// returned even if it expired after the conditional request was sent.
+func (s *validatorStore) load(key string, headers map[string]string) ([]byte, map[string]string, bool) {
+	e, ok := s.entries.peek(key).(*validatorEntry)
+	if !ok {
+		return nil, nil, false
+	}
+
+	merged := map[string]string{}
+	for k, v := range e.headers {
+		merged[k] = v
+	}
+	for k, v := range headers {
+		merged[k] = v
+	}
+	return e.body, merged, true
+}
@@ -0,0 +1,100 @@
+package libstns
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestClient_RequestConditional(t *testing.T) {
+	const lastModified = "Mon, 02 Jan 2006 15:04:05 GMT"
+	tests := []struct {
+		name            string
+		opt             *Options
+		etag            string
+		lastModified    string
+		wantNotModified bool
+	}{
+		{
+			name:            "etag",
+			opt:             &Options{ConditionalRequest: true},
+			etag:            `"v1"`,
+			wantNotModified: true,
+		},
+		{
+			name:            "last modified",
+			opt:             &Options{ConditionalRequest: true},
+			lastModified:    lastModified,
+			wantNotModified: true,
+		},
+		{
+			name: "disabled",
+			opt:  &Options{},
+			etag: `"v1"`,
+		},
+		{
+			name: "no validators",
+			opt:  &Options{ConditionalRequest: true},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				w.Header().Set("User-Highest-Id", "100")
+				if (tt.etag != "" && r.Header.Get("If-None-Match") == tt.etag) ||
+					(tt.lastModified != "" && r.Header.Get("If-Modified-Since") == tt.lastModified) {
+					w.WriteHeader(http.StatusNotModified)
+					return
+				}
+
+				if tt.etag != "" {
+					w.Header().Set("ETag", tt.etag)
+				}
+				if tt.lastModified != "" {
+					w.Header().Set("Last-Modified", tt.lastModified)
+				}
+				fmt.Fprint(w, "it is ok")
+			}))
+			defer ts.Close()
+
+			h, err := newClient(ts.URL, tt.opt)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if _, err := h.Request("users", ""); err != nil {
+				t.Fatal(err)
+			}
+
+			got, err := h.Request("users", "")
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got.NotModified != tt.wantNotModified {
+				t.Errorf("Client.Request() NotModified = %v, want %v", got.NotModified, tt.wantNotModified)
+			}
+			if string(got.Body) != "it is ok" {
+				t.Errorf("Client.Request() Body = %s, want %s", got.Body, "it is ok")
+			}
+			if got.Headers["User-Highest-Id"] != "100" {
+				t.Errorf("Client.Request() Headers = %v", got.Headers)
+			}
+		})
+	}
+}
+
+func TestValidatorStore_Bounded(t *testing.T) {
+	s := newValidatorStore(&Options{CacheSize: 2})
+	for _, key := range []string{"a", "b", "c"} {
+		resp := &http.Response{Header: http.Header{"Etag": {`"` + key + `"`}}}
+		s.store(key, resp, []byte(key), nil)
+	}
+
+	if _, _, ok := s.load("a", nil); ok {
+		t.Error("validatorStore.load(a) found, want evicted")
+	}
+	if body, _, ok := s.load("c", nil); !ok || string(body) != "c" {
+		t.Errorf("validatorStore.load(c) = %s, want c", body)
+	}
+}
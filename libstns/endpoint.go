@@ -0,0 +1,114 @@
+package libstns
+
+import (
+	"net/http"
+	"sort"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+const (
+	// EndpointPolicyPrimary sends every request to the first healthy
+	// endpoint in the configured order.
+	EndpointPolicyPrimary = "primary"
+	// EndpointPolicyRoundRobin spreads requests over the healthy endpoints.
+	EndpointPolicyRoundRobin = "round-robin"
+)
+
+var DefaultEndpointBackoff = 30
+
+type EndpointStatus struct {
+	Endpoint       string
+	Healthy        bool
+	UnhealthyUntil time.Time
+	LastError      error
+}
+
+type endpoint struct {
+	name           string
+	url            string
+	httpClient     *http.Client
+	mu             sync.Mutex
+	unhealthyUntil time.Time
+	lastError      error
+}
+
+func newEndpoint(name string, opt *Options, retry int) (*endpoint, error) {
+	hc, u, err := newHTTPClient(name, opt, retry)
+	if err != nil {
+		return nil, err
+	}
+
+	return &endpoint{
+		name:       name,
+		url:        u,
+		httpClient: hc,
+	}, nil
+}
+
+func (e *endpoint) markHealthy() {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	e.unhealthyUntil = time.Time{}
+	e.lastError = nil
+}
+
+func (e *endpoint) markUnhealthy(err error, backoff time.Duration) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	e.unhealthyUntil = time.Now().Add(backoff)
+	e.lastError = err
+}
+
+func (e *endpoint) status() EndpointStatus {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	return EndpointStatus{
+		Endpoint:       e.name,
+		Healthy:        !time.Now().Before(e.unhealthyUntil),
+		UnhealthyUntil: e.unhealthyUntil,
+		LastError:      e.lastError,
+	}
+}
+
+// candidates returns the endpoints in the order they should be tried.
+// Healthy endpoints come first, ordered by the policy, followed by the
+// unhealthy ones as a last resort, soonest to recover first.
+func (h *client) candidates() []*endpoint {
+	n := len(h.endpoints)
+	start := 0
+	if h.opt.EndpointPolicy == EndpointPolicyRoundRobin {
+		start = int((atomic.AddUint32(&h.next, 1) - 1) % uint32(n))
+	}
+
+	healthy := make([]*endpoint, 0, n)
+	unhealthy := []*endpoint{}
+	until := map[*endpoint]time.Time{}
+	for i := 0; i < n; i++ {
+		e := h.endpoints[(start+i)%n]
+		st := e.status()
+		if st.Healthy {
+			healthy = append(healthy, e)
+			continue
+		}
+		unhealthy = append(unhealthy, e)
+		until[e] = st.UnhealthyUntil
+	}
+
+	sort.SliceStable(unhealthy, func(i, j int) bool {
+		return until[unhealthy[i]].Before(until[unhealthy[j]])
+	})
+	return append(healthy, unhealthy...)
+}
+
+func (h *client) endpointStatus() []EndpointStatus {
+	ret := make([]EndpointStatus, 0, len(h.endpoints))
+	for _, e := range h.endpoints {
+		ret = append(ret, e.status())
+	}
+	return ret
+}
@@ -0,0 +1,233 @@
+package libstns
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestClient_RequestFailover(t *testing.T) {
+	down := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer down.Close()
+
+	newServer := func(body string) *httptest.Server {
+		return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			fmt.Fprint(w, body)
+		}))
+	}
+	up1 := newServer("up1")
+	defer up1.Close()
+	up2 := newServer("up2")
+	defer up2.Close()
+
+	tests := []struct {
+		name      string
+		endpoints []string
+		policy    string
+		want      []string
+	}{
+		{
+			name:      "primary",
+			endpoints: []string{up1.URL, up2.URL},
+			policy:    EndpointPolicyPrimary,
+			want:      []string{up1.URL, up1.URL, up1.URL},
+		},
+		{
+			name:      "primary failover",
+			endpoints: []string{down.URL, up1.URL, up2.URL},
+			policy:    EndpointPolicyPrimary,
+			want:      []string{up1.URL, up1.URL, up1.URL},
+		},
+		{
+			name:      "round robin",
+			endpoints: []string{up1.URL, up2.URL},
+			policy:    EndpointPolicyRoundRobin,
+			want:      []string{up1.URL, up2.URL, up1.URL},
+		},
+		{
+			name:      "round robin failover",
+			endpoints: []string{up1.URL, down.URL, up2.URL},
+			policy:    EndpointPolicyRoundRobin,
+			want:      []string{up1.URL, up2.URL, up2.URL, up1.URL},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			h, err := newClientWithEndpoints(tt.endpoints, &Options{EndpointPolicy: tt.policy})
+			if err != nil {
+				t.Fatal(err)
+			}
+			withoutRetryWait(h)
+
+			for i, want := range tt.want {
+				got, err := h.Request("test", "")
+				if err != nil {
+					t.Fatal(err)
+				}
+				if got.Endpoint != want {
+					t.Errorf("request %d Client.Request() endpoint = %s, want %s", i, got.Endpoint, want)
+				}
+			}
+
+			for _, st := range h.endpointStatus() {
+				if st.Healthy != (st.Endpoint != down.URL) {
+					t.Errorf("Client.endpointStatus() = %+v", st)
+				}
+			}
+		})
+	}
+}
+
+func TestClient_RequestHungEndpoint(t *testing.T) {
+	release := make(chan struct{})
+	hung := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		select {
+		case <-r.Context().Done():
+		case <-release:
+		}
+	}))
+	defer hung.Close()
+	defer close(release)
+
+	up := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, "up")
+	}))
+	defer up.Close()
+
+	h, err := newClientWithEndpoints([]string{hung.URL, up.URL}, &Options{RequestTimeout: 1})
+	if err != nil {
+		t.Fatal(err)
+	}
+	withoutRetryWait(h)
+
+	// the per-attempt timeout fails the hung primary over to the secondary
+	got, err := h.Request("test", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got.Endpoint != up.URL {
+		t.Errorf("Client.Request() endpoint = %s, want %s", got.Endpoint, up.URL)
+	}
+
+	for _, st := range h.endpointStatus() {
+		if st.Healthy != (st.Endpoint == up.URL) {
+			t.Errorf("Client.endpointStatus() = %+v", st)
+		}
+	}
+
+	for i := 0; i < 2; i++ {
+		ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+		got, err := h.RequestContext(ctx, "test", "")
+		cancel()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got.Endpoint != up.URL {
+			t.Errorf("request %d Client.RequestContext() endpoint = %s, want %s", i, got.Endpoint, up.URL)
+		}
+	}
+}
+
+func TestClient_RequestCallerDeadline(t *testing.T) {
+	slow := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		time.Sleep(150 * time.Millisecond)
+		fmt.Fprint(w, "slow")
+	}))
+	defer slow.Close()
+
+	up := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, "up")
+	}))
+	defer up.Close()
+
+	h, err := newClientWithEndpoints([]string{slow.URL, up.URL}, &Options{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	withoutRetryWait(h)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+	if _, err := h.RequestContext(ctx, "test", ""); err == nil {
+		t.Fatal("Client.RequestContext() error = nil, want deadline exceeded")
+	}
+
+	// a caller giving up must not affect the endpoint's health
+	for _, st := range h.endpointStatus() {
+		if !st.Healthy {
+			t.Errorf("Client.endpointStatus() = %+v", st)
+		}
+	}
+
+	got, err := h.Request("test", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got.Endpoint != slow.URL {
+		t.Errorf("Client.Request() endpoint = %s, want %s", got.Endpoint, slow.URL)
+	}
+}
+
+func TestClient_RequestFailoverWithoutRetry(t *testing.T) {
+	var requests int32
+	down := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&requests, 1)
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer down.Close()
+
+	up := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, "up")
+	}))
+	defer up.Close()
+
+	h, err := newClientWithEndpoints([]string{down.URL, up.URL}, &Options{RequestRetry: 3})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	got, err := h.Request("test", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got.Endpoint != up.URL {
+		t.Errorf("Client.Request() endpoint = %s, want %s", got.Endpoint, up.URL)
+	}
+	if n := atomic.LoadInt32(&requests); n != 1 {
+		t.Errorf("requests to the failing endpoint = %d, want 1", n)
+	}
+}
+
+func TestClient_RequestAllEndpointsDown(t *testing.T) {
+	down := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer down.Close()
+
+	h, err := newClientWithEndpoints([]string{down.URL, down.URL}, &Options{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	withoutRetryWait(h)
+
+	for i := 0; i < 2; i++ {
+		if _, err := h.Request("test", ""); err == nil {
+			t.Errorf("request %d Client.Request() error = nil, want error", i)
+		}
+	}
+}
+
+func TestNewClientWithEndpoints(t *testing.T) {
+	if _, err := newClientWithEndpoints(nil, &Options{}); err == nil {
+		t.Error("newClientWithEndpoints() error = nil, want error")
+	}
+	if _, err := newClientWithEndpoints([]string{"http://localhost"}, &Options{EndpointPolicy: "random"}); err == nil {
+		t.Error("newClientWithEndpoints() error = nil, want error")
+	}
+}
@@ -0,0 +1,30 @@
+package libstns
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+)
+
+var (
+	ErrUserNotFound  = errors.New("user not found")
+	ErrGroupNotFound = errors.New("group not found")
+	ErrVerifyFailed  = errors.New("verify failed")
+)
+
+// HTTPError is returned by Request when the server answers with a status
+// other than 200.
+type HTTPError struct {
+	StatusCode int
+	Body       []byte
+	URL        string
+}
+
+func (e *HTTPError) Error() string {
+	return fmt.Sprintf("status code=%d, body=%s", e.StatusCode, string(e.Body))
+}
+
+func isNotFound(err error) bool {
+	var he *HTTPError
+	return errors.As(err, &he) && he.StatusCode == http.StatusNotFound
+}
@@ -0,0 +1,97 @@
+package libstns
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestSTNS_NotFoundErrors(t *testing.T) {
+	tests := []struct {
+		name         string
+		responseCode int
+		responseBody string
+		wantUserErr  error
+		wantGroupErr error
+	}{
+		{
+			name:         "status notfound",
+			responseCode: http.StatusNotFound,
+			wantUserErr:  ErrUserNotFound,
+			wantGroupErr: ErrGroupNotFound,
+		},
+		{
+			name:         "empty list",
+			responseCode: http.StatusOK,
+			responseBody: "[]",
+			wantUserErr:  ErrUserNotFound,
+			wantGroupErr: ErrGroupNotFound,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				w.WriteHeader(tt.responseCode)
+				fmt.Fprint(w, tt.responseBody)
+			}))
+			defer ts.Close()
+
+			h, err := newClient(ts.URL, &Options{})
+			if err != nil {
+				t.Fatal(err)
+			}
+			s := &STNS{
+				client: h,
+			}
+
+			if _, err := s.GetUserByName("example"); !errors.Is(err, tt.wantUserErr) {
+				t.Errorf("STNS.GetUserByName() error = %v, want %v", err, tt.wantUserErr)
+			}
+			if _, err := s.GetUserByID(1); !errors.Is(err, tt.wantUserErr) {
+				t.Errorf("STNS.GetUserByID() error = %v, want %v", err, tt.wantUserErr)
+			}
+			if _, err := s.GetGroupByName("example"); !errors.Is(err, tt.wantGroupErr) {
+				t.Errorf("STNS.GetGroupByName() error = %v, want %v", err, tt.wantGroupErr)
+			}
+			if _, err := s.GetGroupByID(1); !errors.Is(err, tt.wantGroupErr) {
+				t.Errorf("STNS.GetGroupByID() error = %v, want %v", err, tt.wantGroupErr)
+			}
+		})
+	}
+}
+
+func TestClient_RequestHTTPError(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusUnauthorized)
+		fmt.Fprint(w, "unauthorized")
+	}))
+	defer ts.Close()
+
+	h, err := newClient(ts.URL, &Options{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, err = h.Request("users", "name=example")
+	var he *HTTPError
+	if !errors.As(err, &he) {
+		t.Fatalf("Client.Request() error = %v, want *HTTPError", err)
+	}
+	if he.StatusCode != http.StatusUnauthorized || string(he.Body) != "unauthorized" || he.URL != ts.URL+"/users?name=example" {
+		t.Errorf("Client.Request() error = %#v", he)
+	}
+	if err.Error() != "status code=401, body=unauthorized" {
+		t.Errorf("Client.Request() error message = %s", err.Error())
+	}
+}
+
+func TestSTNS_VerifyFailed(t *testing.T) {
+	s := &STNS{}
+	pub := "ssh-ed25519 AAAAC3NzaC1lZDI1NTE5AAAAIB3ZMbMN9hUDFx5AS8XfQ3z3lVCnJ0rBs/kqXv1IL6Q1"
+	err := s.Verify([]byte("test"), []byte(pub), []byte(`{"Format":"ssh-ed25519","Blob":"AAAA","Rest":null}`))
+	if !errors.Is(err, ErrVerifyFailed) {
+		t.Errorf("STNS.Verify() error = %v, want %v", err, ErrVerifyFailed)
+	}
+}
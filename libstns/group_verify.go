@@ -0,0 +1,95 @@
+package libstns
+
+import (
+	"context"
+	"errors"
+	"sync"
+
+	"github.com/STNS/STNS/v2/model"
+)
+
+var DefaultVerifyWorkers = 8
+
+func (s *STNS) VerifyWithGroup(group string, msg, signature []byte) (*model.User, error) {
+	return s.VerifyWithGroupContext(context.Background(), group, msg, signature)
+}
+
+// VerifyWithGroupContext verifies signature against the keys of every
+// member of the group, including the users whose primary group it is, and
+// returns the member whose key matched. Members are looked up by up to
+// Options.VerifyWorkers goroutines and the lookup stops at the first match.
+func (s *STNS) VerifyWithGroupContext(ctx context.Context, group string, msg, signature []byte) (*model.User, error) {
+	members, err := s.MembersOfGroupContext(ctx, group)
+	if err != nil {
+		return nil, err
+	}
+
+	workerCtx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	var mu sync.Mutex
+	var matched *model.User
+	var firstErr error
+
+	names := make(chan string)
+	var wg sync.WaitGroup
+	for i := 0; i < s.verifyWorkers() && i < len(members); i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for name := range names {
+				user, err := s.GetUserByNameContext(workerCtx, name)
+				if err == nil {
+					_, err = s.verifyUser(workerCtx, user, msg, signature)
+				}
+
+				mu.Lock()
+				switch {
+				case err == nil:
+					if matched == nil {
+						matched = user
+						cancel()
+					}
+				case errors.Is(err, ErrUserNotFound), errors.Is(err, ErrVerifyFailed):
+				default:
+					if firstErr == nil && workerCtx.Err() == nil {
+						firstErr = err
+					}
+				}
+				mu.Unlock()
+			}
+		}()
+	}
+
+feed:
+	for _, name := range members {
+		select {
+		case names <- name:
+		case <-workerCtx.Done():
+			break feed
+		}
+	}
+	close(names)
+	wg.Wait()
+
+	if matched != nil {
+		return matched, nil
+	}
+
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	// a failed lookup may have hidden the matching member
+	if firstErr != nil {
+		return nil, firstErr
+	}
+	return nil, ErrVerifyFailed
+}
+
+func (s *STNS) verifyWorkers() int {
+	if s.opt == nil || s.opt.VerifyWorkers <= 0 {
+		return DefaultVerifyWorkers
+	}
+	return s.opt.VerifyWorkers
+}
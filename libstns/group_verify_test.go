@@ -0,0 +1,135 @@
+package libstns
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/STNS/STNS/v2/model"
+	"golang.org/x/crypto/ssh"
+)
+
+func TestSTNS_VerifyWithGroup(t *testing.T) {
+	signers := map[string]ssh.Signer{}
+	for _, name := range []string{"alice", "bob", "carol", "dave", "erin"} {
+		signers[name] = newTestSigner(t)
+	}
+
+	user := func(id int, name string, gid int) *model.User {
+		return &model.User{
+			Base:    model.Base{ID: id, Name: name},
+			GroupID: gid,
+			Keys:    []string{strings.TrimSpace(string(ssh.MarshalAuthorizedKey(signers[name].PublicKey())))},
+		}
+	}
+	users := []*model.User{
+		user(1, "alice", 10),
+		user(2, "bob", 20),
+		user(3, "carol", 10),
+		user(4, "dave", 20),
+		user(5, "erin", 10),
+	}
+	groups := []*model.Group{
+		{Base: model.Base{ID: 10, Name: "dev"}, Users: []string{"bob", "ghost"}},
+		{Base: model.Base{ID: 30, Name: "sre"}, Users: []string{"alice"}},
+	}
+
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var v interface{}
+		switch r.URL.Path {
+		case "/users":
+			if r.FormValue("name") == "erin" {
+				w.WriteHeader(http.StatusInternalServerError)
+				return
+			}
+			ret := []*model.User{}
+			for _, u := range users {
+				if r.FormValue("name") == "" || r.FormValue("name") == u.Name {
+					ret = append(ret, u)
+				}
+			}
+			v = ret
+		case "/groups":
+			ret := []*model.Group{}
+			for _, g := range groups {
+				if r.FormValue("name") == "" || r.FormValue("name") == g.Name {
+					ret = append(ret, g)
+				}
+			}
+			v = ret
+		}
+		rp, err := json.Marshal(v)
+		if err != nil {
+			t.Error(err)
+		}
+		fmt.Fprint(w, string(rp))
+	}))
+	defer ts.Close()
+
+	tests := []struct {
+		name    string
+		group   string
+		signer  string
+		want    string
+		wantErr error
+	}{
+		{name: "listed member", group: "dev", signer: "bob", want: "bob"},
+		{name: "primary group member", group: "dev", signer: "carol", want: "carol"},
+		{name: "single member", group: "sre", signer: "alice", want: "alice"},
+		{name: "not a member", group: "sre", signer: "dave", wantErr: ErrVerifyFailed},
+		{name: "group not found", group: "ops", signer: "bob", wantErr: ErrGroupNotFound},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s, err := NewSTNS(ts.URL, &Options{VerifyWorkers: 2})
+			if err != nil {
+				t.Fatal(err)
+			}
+			withoutRetryWait(s.client)
+			s.SetSigner(signers[tt.signer])
+
+			sig, err := s.Sign([]byte("test"))
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			got, err := s.VerifyWithGroup(tt.group, []byte("test"), sig)
+			if tt.wantErr != nil {
+				if !errors.Is(err, tt.wantErr) {
+					t.Errorf("STNS.VerifyWithGroup() error = %v, want %v", err, tt.wantErr)
+				}
+				return
+			}
+
+			if err != nil {
+				t.Fatalf("STNS.VerifyWithGroup() error = %v", err)
+			}
+			if got.Name != tt.want {
+				t.Errorf("STNS.VerifyWithGroup() = %s, want %s", got.Name, tt.want)
+			}
+		})
+	}
+
+	t.Run("lookup error", func(t *testing.T) {
+		s, err := NewSTNS(ts.URL, &Options{})
+		if err != nil {
+			t.Fatal(err)
+		}
+		withoutRetryWait(s.client)
+		s.SetSigner(signers["dave"])
+
+		sig, err := s.Sign([]byte("test"))
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		var he *HTTPError
+		if _, err := s.VerifyWithGroup("dev", []byte("test"), sig); !errors.As(err, &he) {
+			t.Errorf("STNS.VerifyWithGroup() error = %v, want HTTPError", err)
+		}
+	})
+}
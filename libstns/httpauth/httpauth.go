@@ -0,0 +1,159 @@
+// Package httpauth provides net/http handlers implementing the STNS
+// challenge-response login flow.
+package httpauth
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/url"
+
+	"github.com/STNS/STNS/v2/model"
+	"github.com/STNS/libstns-go/libstns"
+	"github.com/sirupsen/logrus"
+)
+
+type Handler struct {
+	STNS *libstns.STNS
+	// OnSuccess is called once the signature has been verified, for
+	// example to issue a session. When nil, the user name is written as
+	// JSON.
+	OnSuccess func(w http.ResponseWriter, r *http.Request, user *model.User)
+	// ClientAddress returns the address checked against the from= option
+	// of the user's keys. When nil, r.RemoteAddr is used; set it when
+	// running behind a proxy.
+	ClientAddress func(r *http.Request) string
+}
+
+type ChallengeResponse struct {
+	User string `json:"user"`
+	Code string `json:"code"`
+}
+
+type VerifyResponse struct {
+	User string `json:"user"`
+}
+
+type ErrorResponse struct {
+	Error string `json:"error"`
+}
+
+func New(s *libstns.STNS) *Handler {
+	return &Handler{
+		STNS: s,
+	}
+}
+
+// ChallengeHandler issues a challenge code for the "user" form value.
+func (h *Handler) ChallengeHandler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if err := r.ParseForm(); err != nil {
+			WriteError(w, http.StatusBadRequest, "invalid form")
+			return
+		}
+
+		user := r.FormValue("user")
+		if user == "" {
+			WriteError(w, http.StatusBadRequest, "user is required")
+			return
+		}
+
+		code, err := h.STNS.CreateUserChallengeCode(user)
+		if err != nil {
+			if errors.Is(err, libstns.ErrInvalidName) {
+				WriteError(w, http.StatusBadRequest, "invalid user")
+				return
+			}
+			logrus.Errorf("create challenge code error:%s", err.Error())
+			WriteError(w, http.StatusInternalServerError, "internal error")
+			return
+		}
+
+		WriteJSON(w, http.StatusOK, &ChallengeResponse{
+			User: user,
+			Code: string(code),
+		})
+	})
+}
+
+// VerifyHandler verifies the "signature" of the "code" issued to "user".
+// The presented code is consumed before the signature is checked, so a
+// code can be tried only once.
+func (h *Handler) VerifyHandler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if err := r.ParseForm(); err != nil {
+			WriteError(w, http.StatusBadRequest, "invalid form")
+			return
+		}
+
+		name := r.FormValue("user")
+		code := r.FormValue("code")
+		signature := r.FormValue("signature")
+		if name == "" || code == "" || signature == "" {
+			WriteError(w, http.StatusBadRequest, "user, code and signature are required")
+			return
+		}
+
+		if err := libstns.ValidateName(name); err != nil {
+			WriteError(w, http.StatusBadRequest, "invalid user")
+			return
+		}
+
+		if err := h.STNS.TakeUserChallengeCode(name, []byte(code)); err != nil {
+			if errors.Is(err, libstns.ErrChallengeMismatch) {
+				WriteError(w, http.StatusUnauthorized, "verify failed")
+				return
+			}
+			WriteError(w, http.StatusUnauthorized, "challenge code not found or expired")
+			return
+		}
+
+		ctx := libstns.WithClientAddress(r.Context(), h.clientAddress(r))
+		result, err := h.STNS.VerifyWithUserResultContext(ctx, name, []byte(code), []byte(signature))
+		if err != nil {
+			h.writeVerifyError(w, err)
+			return
+		}
+
+		if h.OnSuccess != nil {
+			h.OnSuccess(w, r, result.User)
+			return
+		}
+		WriteJSON(w, http.StatusOK, &VerifyResponse{
+			User: result.User.Name,
+		})
+	})
+}
+
+func (h *Handler) clientAddress(r *http.Request) string {
+	if h.ClientAddress != nil {
+		return h.ClientAddress(r)
+	}
+	return r.RemoteAddr
+}
+
+func (h *Handler) writeVerifyError(w http.ResponseWriter, err error) {
+	var he *libstns.HTTPError
+	var ue *url.Error
+	if errors.As(err, &he) || errors.As(err, &ue) {
+		logrus.Errorf("verify error:%s", err.Error())
+		WriteError(w, http.StatusBadGateway, "stns request failed")
+		return
+	}
+	// unknown user, malformed signature or no matching key
+	WriteError(w, http.StatusUnauthorized, "verify failed")
+}
+
+func WriteJSON(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	if err := json.NewEncoder(w).Encode(v); err != nil {
+		logrus.Errorf("write response error:%s", err.Error())
+	}
+}
+
+func WriteError(w http.ResponseWriter, status int, message string) {
+	WriteJSON(w, status, &ErrorResponse{
+		Error: message,
+	})
+}
@@ -0,0 +1,246 @@
+package httpauth
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"sync/atomic"
+	"testing"
+
+	"github.com/STNS/STNS/v2/model"
+	"github.com/STNS/libstns-go/libstns"
+)
+
+func newTestSTNS(t *testing.T) *libstns.STNS {
+	return newCountingTestSTNS(t, new(int32))
+}
+
+// newCountingTestSTNS is like newTestSTNS but counts the requests made to
+// the STNS server.
+func newCountingTestSTNS(t *testing.T, requests *int32) *libstns.STNS {
+	pub, err := ioutil.ReadFile("../testdata/id_rsa.pub")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(requests, 1)
+		if r.URL.Path != "/users" || r.FormValue("name") != "example" {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		rp, err := json.Marshal([]*model.User{
+			{
+				Base: model.Base{ID: 1, Name: "example"},
+				Keys: []string{string(pub)},
+			},
+		})
+		if err != nil {
+			t.Error(err)
+		}
+		fmt.Fprint(w, string(rp))
+	}))
+	t.Cleanup(ts.Close)
+
+	s, err := libstns.NewSTNS(ts.URL, &libstns.Options{
+		PrivatekeyPath:     "../testdata/id_rsa",
+		PrivatekeyPassword: "test",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	store := libstns.NewMemoryChallengeStore(nil)
+	t.Cleanup(func() { store.Close() })
+	s.SetChallengeStore(store)
+	return s
+}
+
+func postForm(t *testing.T, h http.Handler, values url.Values) *httptest.ResponseRecorder {
+	req := httptest.NewRequest("POST", "/", strings.NewReader(values.Encode()))
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, req)
+	return w
+}
+
+func challenge(t *testing.T, h *Handler, user string) string {
+	w := postForm(t, h.ChallengeHandler(), url.Values{"user": {user}})
+	if w.Code != http.StatusOK {
+		t.Fatalf("ChallengeHandler() status = %d body = %s", w.Code, w.Body.String())
+	}
+
+	var cr ChallengeResponse
+	if err := json.Unmarshal(w.Body.Bytes(), &cr); err != nil {
+		t.Fatal(err)
+	}
+	return cr.Code
+}
+
+func TestHandler_Verify(t *testing.T) {
+	tests := []struct {
+		name       string
+		user       string
+		code       func(issued string) string
+		message    func(issued string) string
+		wantStatus int
+	}{
+		{
+			name:       "ok",
+			user:       "example",
+			code:       func(issued string) string { return issued },
+			message:    func(issued string) string { return issued },
+			wantStatus: http.StatusOK,
+		},
+		{
+			name:       "code mismatch",
+			user:       "example",
+			code:       func(issued string) string { return "other" },
+			message:    func(issued string) string { return "other" },
+			wantStatus: http.StatusUnauthorized,
+		},
+		{
+			name:       "signature mismatch",
+			user:       "example",
+			code:       func(issued string) string { return issued },
+			message:    func(issued string) string { return "other" },
+			wantStatus: http.StatusUnauthorized,
+		},
+		{
+			name:       "unknown user",
+			user:       "unknown",
+			code:       func(issued string) string { return issued },
+			message:    func(issued string) string { return issued },
+			wantStatus: http.StatusUnauthorized,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := newTestSTNS(t)
+			h := New(s)
+
+			issued := challenge(t, h, tt.user)
+			sig, err := s.Sign([]byte(tt.message(issued)))
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			values := url.Values{
+				"user":      {tt.user},
+				"code":      {tt.code(issued)},
+				"signature": {string(sig)},
+			}
+			w := postForm(t, h.VerifyHandler(), values)
+			if w.Code != tt.wantStatus {
+				t.Errorf("VerifyHandler() status = %d, want %d body = %s", w.Code, tt.wantStatus, w.Body.String())
+			}
+			if ct := w.Header().Get("Content-Type"); ct != "application/json" {
+				t.Errorf("VerifyHandler() Content-Type = %s", ct)
+			}
+
+			// the code is consumed whatever the outcome
+			if w := postForm(t, h.VerifyHandler(), values); w.Code != http.StatusUnauthorized {
+				t.Errorf("VerifyHandler() replay status = %d, want %d", w.Code, http.StatusUnauthorized)
+			}
+		})
+	}
+}
+
+func TestHandler_VerifyOutstanding(t *testing.T) {
+	s := newTestSTNS(t)
+	h := New(s)
+
+	// both challenges stay redeemable, in any order
+	first := challenge(t, h, "example")
+	second := challenge(t, h, "example")
+	for _, issued := range []string{first, second} {
+		sig, err := s.Sign([]byte(issued))
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		w := postForm(t, h.VerifyHandler(), url.Values{
+			"user":      {"example"},
+			"code":      {issued},
+			"signature": {string(sig)},
+		})
+		if w.Code != http.StatusOK {
+			t.Errorf("VerifyHandler() status = %d, want %d body = %s", w.Code, http.StatusOK, w.Body.String())
+		}
+	}
+}
+
+func TestHandler_OnSuccess(t *testing.T) {
+	var requests int32
+	s := newCountingTestSTNS(t, &requests)
+	h := New(s)
+
+	var got *model.User
+	h.OnSuccess = func(w http.ResponseWriter, r *http.Request, user *model.User) {
+		got = user
+		w.WriteHeader(http.StatusNoContent)
+	}
+
+	issued := challenge(t, h, "example")
+	sig, err := s.Sign([]byte(issued))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	w := postForm(t, h.VerifyHandler(), url.Values{
+		"user":      {"example"},
+		"code":      {issued},
+		"signature": {string(sig)},
+	})
+	if w.Code != http.StatusNoContent {
+		t.Errorf("VerifyHandler() status = %d, want %d", w.Code, http.StatusNoContent)
+	}
+	if got == nil || got.Name != "example" {
+		t.Errorf("OnSuccess user = %v", got)
+	}
+	if n := atomic.LoadInt32(&requests); n != 1 {
+		t.Errorf("requests = %d, want 1", n)
+	}
+}
+
+func TestHandler_BadRequest(t *testing.T) {
+	h := New(newTestSTNS(t))
+
+	tests := []struct {
+		name    string
+		handler http.Handler
+		values  url.Values
+	}{
+		{
+			name:    "challenge without user",
+			handler: h.ChallengeHandler(),
+			values:  url.Values{},
+		},
+		{
+			name:    "challenge with invalid user",
+			handler: h.ChallengeHandler(),
+			values:  url.Values{"user": {"../etc"}},
+		},
+		{
+			name:    "verify without signature",
+			handler: h.VerifyHandler(),
+			values:  url.Values{"user": {"example"}, "code": {"code"}},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := postForm(t, tt.handler, tt.values)
+			if w.Code != http.StatusBadRequest {
+				t.Errorf("status = %d, want %d", w.Code, http.StatusBadRequest)
+			}
+
+			var er ErrorResponse
+			if err := json.Unmarshal(w.Body.Bytes(), &er); err != nil || er.Error == "" {
+				t.Errorf("body = %s, want JSON error", w.Body.String())
+			}
+		})
+	}
+}
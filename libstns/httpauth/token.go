@@ -0,0 +1,293 @@
+package httpauth
+
+import (
+	"context"
+	"crypto/ed25519"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/STNS/STNS/v2/model"
+	"github.com/STNS/libstns-go/libstns"
+	"github.com/sirupsen/logrus"
+)
+
+const (
+	AlgHS256 = "HS256"
+	AlgEdDSA = "EdDSA"
+)
+
+const minHMACKeyLength = 32
+
+var DefaultTokenTTL = 3600
+
+var (
+	ErrInvalidToken = errors.New("invalid token")
+	ErrTokenExpired = errors.New("token expired")
+)
+
+// Claims is the payload of a session token issued after a successful
+// verification.
+type Claims struct {
+	User      string   `json:"sub"`
+	UID       int      `json:"uid"`
+	GID       int      `json:"gid"`
+	Groups    []string `json:"groups,omitempty"`
+	IssuedAt  int64    `json:"iat"`
+	ExpiresAt int64    `json:"exp"`
+}
+
+type tokenHeader struct {
+	Alg string `json:"alg"`
+	Typ string `json:"typ"`
+}
+
+// TokenIssuer mints compact tokens of the form header.claims.signature,
+// each part base64url encoded, signed with HMAC-SHA256 or Ed25519.
+type TokenIssuer struct {
+	alg     string
+	hmacKey []byte
+	edKey   ed25519.PrivateKey
+	ttl     time.Duration
+}
+
+type TokenVerifier struct {
+	alg     string
+	hmacKey []byte
+	edKey   ed25519.PublicKey
+}
+
+type TokenResponse struct {
+	User      string `json:"user"`
+	Token     string `json:"token"`
+	ExpiresAt int64  `json:"expires_at"`
+}
+
+type contextKey int
+
+const (
+	userContextKey contextKey = iota
+	claimsContextKey
+)
+
+func NewHMACTokenIssuer(key []byte, ttl time.Duration) (*TokenIssuer, error) {
+	if len(key) < minHMACKeyLength {
+		return nil, fmt.Errorf("hmac key must be at least %d bytes", minHMACKeyLength)
+	}
+	return &TokenIssuer{
+		alg:     AlgHS256,
+		hmacKey: key,
+		ttl:     tokenTTL(ttl),
+	}, nil
+}
+
+func NewEd25519TokenIssuer(key ed25519.PrivateKey, ttl time.Duration) (*TokenIssuer, error) {
+	if len(key) != ed25519.PrivateKeySize {
+		return nil, errors.New("invalid ed25519 private key")
+	}
+	return &TokenIssuer{
+		alg:   AlgEdDSA,
+		edKey: key,
+		ttl:   tokenTTL(ttl),
+	}, nil
+}
+
+func NewHMACTokenVerifier(key []byte) (*TokenVerifier, error) {
+	if len(key) < minHMACKeyLength {
+		return nil, fmt.Errorf("hmac key must be at least %d bytes", minHMACKeyLength)
+	}
+	return &TokenVerifier{
+		alg:     AlgHS256,
+		hmacKey: key,
+	}, nil
+}
+
+func NewEd25519TokenVerifier(key ed25519.PublicKey) (*TokenVerifier, error) {
+	if len(key) != ed25519.PublicKeySize {
+		return nil, errors.New("invalid ed25519 public key")
+	}
+	return &TokenVerifier{
+		alg:   AlgEdDSA,
+		edKey: key,
+	}, nil
+}
+
+func tokenTTL(ttl time.Duration) time.Duration {
+	if ttl == 0 {
+		return time.Duration(DefaultTokenTTL) * time.Second
+	}
+	return ttl
+}
+
+func (i *TokenIssuer) Issue(user *model.User, groups []string) (string, *Claims, error) {
+	now := time.Now()
+	claims := &Claims{
+		User:      user.Name,
+		UID:       user.ID,
+		GID:       user.GroupID,
+		Groups:    groups,
+		IssuedAt:  now.Unix(),
+		ExpiresAt: now.Add(i.ttl).Unix(),
+	}
+
+	h, err := json.Marshal(&tokenHeader{Alg: i.alg, Typ: "JWT"})
+	if err != nil {
+		return "", nil, err
+	}
+
+	c, err := json.Marshal(claims)
+	if err != nil {
+		return "", nil, err
+	}
+
+	signingInput := encodeSegment(h) + "." + encodeSegment(c)
+
+	var sig []byte
+	switch i.alg {
+	case AlgHS256:
+		mac := hmac.New(sha256.New, i.hmacKey)
+		mac.Write([]byte(signingInput))
+		sig = mac.Sum(nil)
+	case AlgEdDSA:
+		sig = ed25519.Sign(i.edKey, []byte(signingInput))
+	}
+
+	return signingInput + "." + encodeSegment(sig), claims, nil
+}
+
+func (v *TokenVerifier) Verify(token string) (*Claims, error) {
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		return nil, ErrInvalidToken
+	}
+
+	hb, err := decodeSegment(parts[0])
+	if err != nil {
+		return nil, ErrInvalidToken
+	}
+
+	var h tokenHeader
+	if err := json.Unmarshal(hb, &h); err != nil || h.Alg != v.alg {
+		return nil, ErrInvalidToken
+	}
+
+	sig, err := decodeSegment(parts[2])
+	if err != nil {
+		return nil, ErrInvalidToken
+	}
+
+	signingInput := parts[0] + "." + parts[1]
+	switch v.alg {
+	case AlgHS256:
+		mac := hmac.New(sha256.New, v.hmacKey)
+		mac.Write([]byte(signingInput))
+		if !hmac.Equal(sig, mac.Sum(nil)) {
+			return nil, ErrInvalidToken
+		}
+	case AlgEdDSA:
+		if !ed25519.Verify(v.edKey, []byte(signingInput), sig) {
+			return nil, ErrInvalidToken
+		}
+	default:
+		return nil, ErrInvalidToken
+	}
+
+	cb, err := decodeSegment(parts[1])
+	if err != nil {
+		return nil, ErrInvalidToken
+	}
+
+	var claims Claims
+	if err := json.Unmarshal(cb, &claims); err != nil || claims.User == "" {
+		return nil, ErrInvalidToken
+	}
+
+	if time.Now().Unix() >= claims.ExpiresAt {
+		return nil, ErrTokenExpired
+	}
+	return &claims, nil
+}
+
+// Middleware verifies the bearer token of each request and stores the
+// claims and the *model.User they describe in the request context. Requests
+// without a valid token are rejected with 401.
+func (v *TokenVerifier) Middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		auth := r.Header.Get("Authorization")
+		if !strings.HasPrefix(auth, "Bearer ") {
+			WriteError(w, http.StatusUnauthorized, "token is required")
+			return
+		}
+
+		claims, err := v.Verify(strings.TrimPrefix(auth, "Bearer "))
+		if err != nil {
+			WriteError(w, http.StatusUnauthorized, err.Error())
+			return
+		}
+
+		ctx := context.WithValue(r.Context(), claimsContextKey, claims)
+		ctx = context.WithValue(ctx, userContextKey, &model.User{
+			Base: model.Base{
+				ID:   claims.UID,
+				Name: claims.User,
+			},
+			GroupID: claims.GID,
+		})
+		next.ServeHTTP(w, r.WithContext(ctx))
+	})
+}
+
+// TokenOnSuccess returns an OnSuccess hook that issues a token carrying the
+// names of the user's groups.
+func TokenOnSuccess(s *libstns.STNS, issuer *TokenIssuer) func(http.ResponseWriter, *http.Request, *model.User) {
+	return func(w http.ResponseWriter, r *http.Request, user *model.User) {
+		groups, err := s.GroupsForUserContext(r.Context(), user.Name)
+		if err != nil {
+			logrus.Errorf("resolve groups error:%s", err.Error())
+			WriteError(w, http.StatusBadGateway, "stns request failed")
+			return
+		}
+
+		names := []string{}
+		for _, g := range groups {
+			names = append(names, g.Name)
+		}
+
+		token, claims, err := issuer.Issue(user, names)
+		if err != nil {
+			logrus.Errorf("issue token error:%s", err.Error())
+			WriteError(w, http.StatusInternalServerError, "internal error")
+			return
+		}
+
+		WriteJSON(w, http.StatusOK, &TokenResponse{
+			User:      user.Name,
+			Token:     token,
+			ExpiresAt: claims.ExpiresAt,
+		})
+	}
+}
+
+func UserFromContext(ctx context.Context) (*model.User, bool) {
+	u, ok := ctx.Value(userContextKey).(*model.User)
+	return u, ok
+}
+
+func ClaimsFromContext(ctx context.Context) (*Claims, bool) {
+	c, ok := ctx.Value(claimsContextKey).(*Claims)
+	return c, ok
+}
+
+func encodeSegment(b []byte) string {
+	return base64.RawURLEncoding.EncodeToString(b)
+}
+
+func decodeSegment(s string) ([]byte, error) {
+	return base64.RawURLEncoding.DecodeString(s)
+}
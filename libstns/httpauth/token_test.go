@@ -0,0 +1,199 @@
+package httpauth
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/STNS/STNS/v2/model"
+)
+
+func TestToken(t *testing.T) {
+	hmacKey := []byte(strings.Repeat("k", minHMACKeyLength))
+	pub, priv, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	otherPub, _, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	hmacIssuer, err := NewHMACTokenIssuer(hmacKey, time.Minute)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expiredIssuer, err := NewHMACTokenIssuer(hmacKey, -time.Minute)
+	if err != nil {
+		t.Fatal(err)
+	}
+	edIssuer, err := NewEd25519TokenIssuer(priv, time.Minute)
+	if err != nil {
+		t.Fatal(err)
+	}
+	hmacVerifier, err := NewHMACTokenVerifier(hmacKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	otherHMACVerifier, err := NewHMACTokenVerifier([]byte(strings.Repeat("x", minHMACKeyLength)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	edVerifier, err := NewEd25519TokenVerifier(pub)
+	if err != nil {
+		t.Fatal(err)
+	}
+	otherEdVerifier, err := NewEd25519TokenVerifier(otherPub)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	user := &model.User{Base: model.Base{ID: 1000, Name: "example"}, GroupID: 2000}
+	tests := []struct {
+		name     string
+		issuer   *TokenIssuer
+		verifier *TokenVerifier
+		tamper   func(string) string
+		wantErr  error
+	}{
+		{name: "hmac", issuer: hmacIssuer, verifier: hmacVerifier},
+		{name: "ed25519", issuer: edIssuer, verifier: edVerifier},
+		{name: "hmac wrong key", issuer: hmacIssuer, verifier: otherHMACVerifier, wantErr: ErrInvalidToken},
+		{name: "ed25519 wrong key", issuer: edIssuer, verifier: otherEdVerifier, wantErr: ErrInvalidToken},
+		{name: "algorithm mismatch", issuer: hmacIssuer, verifier: edVerifier, wantErr: ErrInvalidToken},
+		{name: "expired", issuer: expiredIssuer, verifier: hmacVerifier, wantErr: ErrTokenExpired},
+		{
+			name:     "tampered claims",
+			issuer:   hmacIssuer,
+			verifier: hmacVerifier,
+			tamper: func(token string) string {
+				parts := strings.Split(token, ".")
+				parts[1] = encodeSegment([]byte(`{"sub":"root","uid":0,"exp":9999999999}`))
+				return strings.Join(parts, ".")
+			},
+			wantErr: ErrInvalidToken,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			token, claims, err := tt.issuer.Issue(user, []string{"dev"})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if tt.tamper != nil {
+				token = tt.tamper(token)
+			}
+
+			got, err := tt.verifier.Verify(token)
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("TokenVerifier.Verify() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if err == nil && !reflect.DeepEqual(got, claims) {
+				t.Errorf("TokenVerifier.Verify() = %+v, want %+v", got, claims)
+			}
+		})
+	}
+}
+
+func TestTokenVerifier_Middleware(t *testing.T) {
+	key := []byte(strings.Repeat("k", minHMACKeyLength))
+	issuer, err := NewHMACTokenIssuer(key, time.Minute)
+	if err != nil {
+		t.Fatal(err)
+	}
+	verifier, err := NewHMACTokenVerifier(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	token, _, err := issuer.Issue(&model.User{Base: model.Base{ID: 1000, Name: "example"}, GroupID: 2000}, []string{"dev"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	h := verifier.Middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		user, ok := UserFromContext(r.Context())
+		if !ok || user.Name != "example" || user.ID != 1000 || user.GroupID != 2000 {
+			t.Errorf("UserFromContext() = %v, %v", user, ok)
+		}
+		claims, ok := ClaimsFromContext(r.Context())
+		if !ok || !reflect.DeepEqual(claims.Groups, []string{"dev"}) {
+			t.Errorf("ClaimsFromContext() = %v, %v", claims, ok)
+		}
+		w.WriteHeader(http.StatusNoContent)
+	}))
+
+	tests := []struct {
+		name       string
+		auth       string
+		wantStatus int
+	}{
+		{name: "ok", auth: "Bearer " + token, wantStatus: http.StatusNoContent},
+		{name: "missing", auth: "", wantStatus: http.StatusUnauthorized},
+		{name: "invalid", auth: "Bearer invalid", wantStatus: http.StatusUnauthorized},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest("GET", "/", nil)
+			if tt.auth != "" {
+				req.Header.Set("Authorization", tt.auth)
+			}
+			w := httptest.NewRecorder()
+			h.ServeHTTP(w, req)
+			if w.Code != tt.wantStatus {
+				t.Errorf("status = %d, want %d", w.Code, tt.wantStatus)
+			}
+		})
+	}
+}
+
+func TestTokenOnSuccess(t *testing.T) {
+	s := newTestSTNS(t)
+	key := []byte(strings.Repeat("k", minHMACKeyLength))
+	issuer, err := NewHMACTokenIssuer(key, time.Minute)
+	if err != nil {
+		t.Fatal(err)
+	}
+	verifier, err := NewHMACTokenVerifier(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	h := New(s)
+	h.OnSuccess = TokenOnSuccess(s, issuer)
+
+	issued := challenge(t, h, "example")
+	sig, err := s.Sign([]byte(issued))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	w := postForm(t, h.VerifyHandler(), url.Values{
+		"user":      {"example"},
+		"code":      {issued},
+		"signature": {string(sig)},
+	})
+	if w.Code != http.StatusOK {
+		t.Fatalf("VerifyHandler() status = %d body = %s", w.Code, w.Body.String())
+	}
+
+	var tr TokenResponse
+	if err := json.Unmarshal(w.Body.Bytes(), &tr); err != nil {
+		t.Fatal(err)
+	}
+	claims, err := verifier.Verify(tr.Token)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if claims.User != "example" || claims.UID != 1 || claims.ExpiresAt != tr.ExpiresAt {
+		t.Errorf("claims = %+v", claims)
+	}
+}
@@ -0,0 +1,148 @@
+package libstns
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+var DefaultIDRangeMaxAge = 600
+
+var ErrIDRangeUnavailable = errors.New("id range unavailable")
+
+// IDRange is the range of IDs managed by STNS, as reported by the
+// *-lowest-id and *-highest-id response headers.
+type IDRange struct {
+	Lowest  int
+	Highest int
+}
+
+type idRangeState struct {
+	mu         sync.RWMutex
+	idRange    *IDRange
+	observedAt time.Time
+}
+
+func (st *idRangeState) set(r *IDRange) {
+	st.mu.Lock()
+	defer st.mu.Unlock()
+
+	st.idRange = r
+	st.observedAt = time.Now()
+}
+
+// get returns the last observed range, or nil when none was observed
+// within maxAge. A zero maxAge accepts a range of any age.
+func (st *idRangeState) get(maxAge time.Duration) *IDRange {
+	st.mu.RLock()
+	defer st.mu.RUnlock()
+
+	if st.idRange == nil || (maxAge > 0 && time.Since(st.observedAt) > maxAge) {
+		return nil
+	}
+	r := *st.idRange
+	return &r
+}
+
+func (s *STNS) UserIDRange() (*IDRange, error) {
+	return s.UserIDRangeContext(context.Background())
+}
+
+// UserIDRangeContext returns the user ID range. The range observed on a
+// previous response is reused for up to Options.IDRangeMaxAge seconds,
+// otherwise the users are listed to refresh it.
+func (s *STNS) UserIDRangeContext(ctx context.Context) (*IDRange, error) {
+	if r := s.recentIDRange(&s.userIDRange); r != nil {
+		return r, nil
+	}
+
+	if _, err := s.ListUserContext(ctx); err != nil {
+		return nil, err
+	}
+
+	if r := s.userIDRange.get(0); r != nil {
+		return r, nil
+	}
+	return nil, ErrIDRangeUnavailable
+}
+
+func (s *STNS) GroupIDRange() (*IDRange, error) {
+	return s.GroupIDRangeContext(context.Background())
+}
+
+// GroupIDRangeContext returns the group ID range. See UserIDRangeContext.
+func (s *STNS) GroupIDRangeContext(ctx context.Context) (*IDRange, error) {
+	if r := s.recentIDRange(&s.groupIDRange); r != nil {
+		return r, nil
+	}
+
+	if _, err := s.ListGroupContext(ctx); err != nil {
+		return nil, err
+	}
+
+	if r := s.groupIDRange.get(0); r != nil {
+		return r, nil
+	}
+	return nil, ErrIDRangeUnavailable
+}
+
+// recentIDRange returns the recorded range if it is recent enough. The
+// range has its own max age so it is reused whether or not the cache is
+// enabled.
+func (s *STNS) recentIDRange(st *idRangeState) *IDRange {
+	maxAge := DefaultIDRangeMaxAge
+	if s.opt != nil && s.opt.IDRangeMaxAge != 0 {
+		maxAge = s.opt.IDRangeMaxAge
+	}
+	return st.get(time.Duration(maxAge) * time.Second)
+}
+
+// observeIDRange records the ID ranges carried by a response. Stale
+// responses are ignored so they never replace a fresher range.
+func (s *STNS) observeIDRange(r *Response) {
+	if r == nil || r.Stale {
+		return
+	}
+
+	if ur, err := parseIDRange(r.Headers, "user"); err == nil {
+		s.userIDRange.set(ur)
+	}
+
+	if gr, err := parseIDRange(r.Headers, "group"); err == nil {
+		s.groupIDRange.set(gr)
+	}
+}
+
+func parseIDRange(headers map[string]string, kind string) (*IDRange, error) {
+	lowest, err := parseIDHeader(headers, kind+"-lowest-id")
+	if err != nil {
+		return nil, err
+	}
+
+	highest, err := parseIDHeader(headers, kind+"-highest-id")
+	if err != nil {
+		return nil, err
+	}
+
+	return &IDRange{
+		Lowest:  lowest,
+		Highest: highest,
+	}, nil
+}
+
+func parseIDHeader(headers map[string]string, name string) (int, error) {
+	for k, v := range headers {
+		if strings.ToLower(k) == name {
+			id, err := strconv.Atoi(strings.TrimSpace(v))
+			if err != nil {
+				return 0, fmt.Errorf("invalid header %s:%s", name, v)
+			}
+			return id, nil
+		}
+	}
+	return 0, ErrIDRangeUnavailable
+}
@@ -0,0 +1,133 @@
+package libstns
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestSTNS_IDRange(t *testing.T) {
+	tests := []struct {
+		name         string
+		opt          *Options
+		headers      map[string]string
+		wantUser     *IDRange
+		wantGroup    *IDRange
+		wantErr      error
+		wantRequests int32
+	}{
+		{
+			name: "ok",
+			opt:  &Options{},
+			headers: map[string]string{
+				"User-Lowest-Id":   "1000",
+				"User-Highest-Id":  "1999",
+				"Group-Lowest-Id":  "2000",
+				"Group-Highest-Id": "2999",
+			},
+			wantUser:     &IDRange{Lowest: 1000, Highest: 1999},
+			wantGroup:    &IDRange{Lowest: 2000, Highest: 2999},
+			wantRequests: 1,
+		},
+		{
+			name: "cached",
+			opt:  &Options{Cache: true},
+			headers: map[string]string{
+				"User-Lowest-Id":   "1000",
+				"User-Highest-Id":  "1999",
+				"Group-Lowest-Id":  "2000",
+				"Group-Highest-Id": "2999",
+			},
+			wantUser:     &IDRange{Lowest: 1000, Highest: 1999},
+			wantGroup:    &IDRange{Lowest: 2000, Highest: 2999},
+			wantRequests: 1,
+		},
+		{
+			name:         "unavailable",
+			opt:          &Options{},
+			headers:      map[string]string{},
+			wantErr:      ErrIDRangeUnavailable,
+			wantRequests: 3,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var requests int32
+			ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				atomic.AddInt32(&requests, 1)
+				for k, v := range tt.headers {
+					w.Header().Set(k, v)
+				}
+				fmt.Fprint(w, "[]")
+			}))
+			defer ts.Close()
+
+			s, err := NewSTNS(ts.URL, tt.opt)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if _, err := s.ListUser(); err != nil {
+				t.Fatal(err)
+			}
+
+			gotUser, err := s.UserIDRange()
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("STNS.UserIDRange() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if !reflect.DeepEqual(gotUser, tt.wantUser) {
+				t.Errorf("STNS.UserIDRange() = %v, want %v", gotUser, tt.wantUser)
+			}
+
+			gotGroup, err := s.GroupIDRange()
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("STNS.GroupIDRange() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if !reflect.DeepEqual(gotGroup, tt.wantGroup) {
+				t.Errorf("STNS.GroupIDRange() = %v, want %v", gotGroup, tt.wantGroup)
+			}
+
+			if n := atomic.LoadInt32(&requests); n != tt.wantRequests {
+				t.Errorf("requests = %d, want %d", n, tt.wantRequests)
+			}
+		})
+	}
+}
+
+func TestSTNS_IDRangeMaxAge(t *testing.T) {
+	var requests int32
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&requests, 1)
+		w.Header().Set("User-Lowest-Id", "1000")
+		w.Header().Set("User-Highest-Id", "1999")
+		fmt.Fprint(w, "[]")
+	}))
+	defer ts.Close()
+
+	s, err := NewSTNS(ts.URL, &Options{IDRangeMaxAge: 1})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for i := 0; i < 2; i++ {
+		if _, err := s.UserIDRange(); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if n := atomic.LoadInt32(&requests); n != 1 {
+		t.Errorf("requests = %d, want 1", n)
+	}
+
+	time.Sleep(1100 * time.Millisecond)
+	if _, err := s.UserIDRange(); err != nil {
+		t.Fatal(err)
+	}
+	if n := atomic.LoadInt32(&requests); n != 2 {
+		t.Errorf("requests = %d, want 2", n)
+	}
+}
@@ -0,0 +1,147 @@
+package libstns
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"path"
+	"strings"
+	"time"
+)
+
+var ErrKeyOptionRejected = errors.New("key option rejected")
+
+var expiryTimeLayouts = []string{
+	"20060102150405",
+	"200601021504",
+	"20060102",
+}
+
+type clientAddressKey struct{}
+
+// WithClientAddress returns a context carrying the address of the client
+// being authenticated, used to enforce the from= option of authorized keys.
+// addr is an IP address, optionally with a port.
+func WithClientAddress(ctx context.Context, addr string) context.Context {
+	return context.WithValue(ctx, clientAddressKey{}, addr)
+}
+
+func clientAddress(ctx context.Context) net.IP {
+	addr, ok := ctx.Value(clientAddressKey{}).(string)
+	if !ok {
+		return nil
+	}
+
+	if host, _, err := net.SplitHostPort(addr); err == nil {
+		addr = host
+	}
+	return net.ParseIP(addr)
+}
+
+// checkKeyOptions enforces the options of an authorized key when
+// Options.KeyOptionsPolicy is set.
+func (c *STNS) checkKeyOptions(ctx context.Context, options []string) error {
+	if c.opt == nil || !c.opt.KeyOptionsPolicy {
+		return nil
+	}
+
+	for _, o := range options {
+		name, value := splitKeyOption(o)
+		for _, r := range c.opt.RejectKeyOptions {
+			if strings.EqualFold(name, r) {
+				return fmt.Errorf("%w: %s", ErrKeyOptionRejected, name)
+			}
+		}
+
+		switch strings.ToLower(name) {
+		case "expiry-time":
+			expire, err := parseExpiryTime(value)
+			if err != nil {
+				return fmt.Errorf("%w: %s", ErrKeyOptionRejected, err.Error())
+			}
+
+			if !time.Now().Before(expire) {
+				return fmt.Errorf("%w: key expired at %s", ErrKeyOptionRejected, expire)
+			}
+		case "from":
+			addr := clientAddress(ctx)
+			if addr == nil {
+				return fmt.Errorf("%w: from= requires the client address", ErrKeyOptionRejected)
+			}
+
+			if !matchAddressList(addr, value) {
+				return fmt.Errorf("%w: %s is not allowed by from=%q", ErrKeyOptionRejected, addr, value)
+			}
+		}
+	}
+	return nil
+}
+
+func splitKeyOption(o string) (string, string) {
+	i := strings.Index(o, "=")
+	if i < 0 {
+		return o, ""
+	}
+
+	value := o[i+1:]
+	if len(value) >= 2 && strings.HasPrefix(value, `"`) && strings.HasSuffix(value, `"`) {
+		value = strings.ReplaceAll(value[1:len(value)-1], `\"`, `"`)
+	}
+	return o[:i], value
+}
+
+// parseExpiryTime parses YYYYMMDD[HHMM[SS]] in local time, or in UTC when
+// suffixed with Z, as sshd does.
+func parseExpiryTime(v string) (time.Time, error) {
+	loc := time.Local
+	if strings.HasSuffix(v, "Z") || strings.HasSuffix(v, "z") {
+		loc = time.UTC
+		v = v[:len(v)-1]
+	}
+
+	for _, layout := range expiryTimeLayouts {
+		if len(v) != len(layout) {
+			continue
+		}
+		return time.ParseInLocation(layout, v, loc)
+	}
+	return time.Time{}, fmt.Errorf("invalid expiry-time %q", v)
+}
+
+// matchAddressList matches addr against a comma separated list of
+// addresses, CIDRs and wildcard patterns. Like sshd, any matching negated
+// pattern denies the address. Host names never match because the address
+// is not resolved.
+func matchAddressList(addr net.IP, list string) bool {
+	matched := false
+	for _, p := range strings.Split(list, ",") {
+		p = strings.TrimSpace(p)
+		negate := strings.HasPrefix(p, "!")
+		p = strings.TrimPrefix(p, "!")
+
+		if !matchAddress(addr, p) {
+			continue
+		}
+
+		if negate {
+			return false
+		}
+		matched = true
+	}
+	return matched
+}
+
+func matchAddress(addr net.IP, pattern string) bool {
+	if strings.Contains(pattern, "/") {
+		_, n, err := net.ParseCIDR(pattern)
+		return err == nil && n.Contains(addr)
+	}
+
+	if ip := net.ParseIP(pattern); ip != nil {
+		return ip.Equal(addr)
+	}
+
+	ok, err := path.Match(strings.ToLower(pattern), addr.String())
+	return err == nil && ok
+}
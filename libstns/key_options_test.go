@@ -0,0 +1,133 @@
+package libstns
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"golang.org/x/crypto/ssh"
+)
+
+func TestSTNS_VerifyKeyOptions(t *testing.T) {
+	signer := newTestSigner(t)
+	c := &STNS{
+		opt: &Options{
+			KeyOptionsPolicy: true,
+			RejectKeyOptions: []string{"stns-disabled"},
+		},
+	}
+	c.SetSigner(signer)
+
+	sig, err := c.Sign([]byte("test"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	key := strings.TrimSpace(string(ssh.MarshalAuthorizedKey(signer.PublicKey())))
+
+	future := time.Now().Add(time.Hour).UTC().Format("200601021504") + "Z"
+	past := time.Now().Add(-time.Hour).UTC().Format("20060102150405") + "Z"
+
+	tests := []struct {
+		name    string
+		options string
+		addr    string
+		policy  bool
+		wantErr error
+	}{
+		{
+			name:    "no options",
+			options: "",
+			policy:  true,
+		},
+		{
+			name:    "restrict is ignored",
+			options: "restrict,no-pty ",
+			policy:  true,
+		},
+		{
+			name:    "not expired",
+			options: `expiry-time="` + future + `" `,
+			policy:  true,
+		},
+		{
+			name:    "expired",
+			options: `expiry-time="` + past + `" `,
+			policy:  true,
+			wantErr: ErrKeyOptionRejected,
+		},
+		{
+			name:    "expired without policy",
+			options: `expiry-time="` + past + `" `,
+		},
+		{
+			name:    "invalid expiry-time",
+			options: `expiry-time="2030" `,
+			policy:  true,
+			wantErr: ErrKeyOptionRejected,
+		},
+		{
+			name:    "from address",
+			options: `from="192.0.2.1" `,
+			addr:    "192.0.2.1:50000",
+			policy:  true,
+		},
+		{
+			name:    "from cidr",
+			options: `from="10.0.0.0/8,192.0.2.0/24" `,
+			addr:    "192.0.2.10",
+			policy:  true,
+		},
+		{
+			name:    "from wildcard",
+			options: `from="192.0.2.*" `,
+			addr:    "192.0.2.10",
+			policy:  true,
+		},
+		{
+			name:    "from negated",
+			options: `from="192.0.2.0/24,!192.0.2.10" `,
+			addr:    "192.0.2.10",
+			policy:  true,
+			wantErr: ErrKeyOptionRejected,
+		},
+		{
+			name:    "from unmatch",
+			options: `from="10.0.0.0/8" `,
+			addr:    "192.0.2.10",
+			policy:  true,
+			wantErr: ErrKeyOptionRejected,
+		},
+		{
+			name:    "from without client address",
+			options: `from="10.0.0.0/8" `,
+			policy:  true,
+			wantErr: ErrKeyOptionRejected,
+		},
+		{
+			name:    "custom option",
+			options: "stns-disabled ",
+			policy:  true,
+			wantErr: ErrKeyOptionRejected,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c.opt.KeyOptionsPolicy = tt.policy
+
+			ctx := context.Background()
+			if tt.addr != "" {
+				ctx = WithClientAddress(ctx, tt.addr)
+			}
+
+			err := c.VerifyContext(ctx, []byte("test"), []byte(tt.options+key), sig)
+			if tt.wantErr == nil && err != nil {
+				t.Errorf("STNS.VerifyContext() error = %v", err)
+			}
+			if tt.wantErr != nil && !errors.Is(err, tt.wantErr) {
+				t.Errorf("STNS.VerifyContext() error = %v, want %v", err, tt.wantErr)
+			}
+		})
+	}
+}
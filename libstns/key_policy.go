@@ -0,0 +1,67 @@
+package libstns
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"errors"
+	"fmt"
+
+	"github.com/thoas/go-funk"
+	"golang.org/x/crypto/ssh"
+)
+
+var ErrKeyPolicy = errors.New("rejected by key policy")
+
+// checkKeyPolicy enforces Options.AllowedKeyTypes and Options.MinRSAKeySize.
+// A certificate is checked by the key it certifies.
+func (c *STNS) checkKeyPolicy(publicKey ssh.PublicKey) error {
+	if c.opt == nil {
+		return nil
+	}
+
+	if cert, ok := publicKey.(*ssh.Certificate); ok {
+		publicKey = cert.Key
+	}
+
+	if len(c.opt.AllowedKeyTypes) > 0 && !funk.ContainsString(c.opt.AllowedKeyTypes, publicKey.Type()) {
+		return fmt.Errorf("%w: key type %s is not allowed", ErrKeyPolicy, publicKey.Type())
+	}
+
+	if c.opt.MinRSAKeySize > 0 && publicKey.Type() == ssh.KeyAlgoRSA {
+		cpk, ok := publicKey.(ssh.CryptoPublicKey)
+		if !ok {
+			return fmt.Errorf("%w: can't read rsa key size", ErrKeyPolicy)
+		}
+
+		pub, ok := cpk.CryptoPublicKey().(*rsa.PublicKey)
+		if !ok {
+			return fmt.Errorf("%w: can't read rsa key size", ErrKeyPolicy)
+		}
+
+		if pub.N.BitLen() < c.opt.MinRSAKeySize {
+			return fmt.Errorf("%w: rsa key size %d is less than %d", ErrKeyPolicy, pub.N.BitLen(), c.opt.MinRSAKeySize)
+		}
+	}
+	return nil
+}
+
+// checkSignaturePolicy enforces Options.AllowedSignatureFormats.
+func (c *STNS) checkSignaturePolicy(format string) error {
+	if c.opt == nil || len(c.opt.AllowedSignatureFormats) == 0 {
+		return nil
+	}
+
+	if !funk.ContainsString(c.opt.AllowedSignatureFormats, format) {
+		return fmt.Errorf("%w: signature format %s is not allowed", ErrKeyPolicy, format)
+	}
+	return nil
+}
+
+// signData signs with rsa-sha2-512 instead of the SHA-1 based ssh-rsa for
+// RSA keys.
+func signData(signer ssh.Signer, data []byte) (*ssh.Signature, error) {
+	if as, ok := signer.(ssh.AlgorithmSigner); ok && isRSAKey(signer.PublicKey()) {
+		return as.SignWithAlgorithm(rand.Reader, data, ssh.KeyAlgoRSASHA512)
+	}
+	return signer.Sign(rand.Reader, data)
+}
@@ -0,0 +1,112 @@
+package libstns
+
+import (
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"testing"
+
+	"golang.org/x/crypto/ssh"
+)
+
+func TestSTNS_SignRSAAlgorithm(t *testing.T) {
+	c := &STNS{
+		opt: &Options{
+			PrivatekeyPath:     "./testdata/id_rsa",
+			PrivatekeyPassword: "test",
+		},
+	}
+
+	got, err := c.Sign([]byte("test"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var sig ssh.Signature
+	if err := json.Unmarshal(got, &sig); err != nil {
+		t.Fatal(err)
+	}
+	if sig.Format != ssh.KeyAlgoRSASHA512 {
+		t.Errorf("STNS.Sign() format = %s, want %s", sig.Format, ssh.KeyAlgoRSASHA512)
+	}
+}
+
+func TestSTNS_VerifyKeyPolicy(t *testing.T) {
+	pub, err := ioutil.ReadFile("./testdata/id_rsa.pub")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	signer := &STNS{
+		opt: &Options{
+			PrivatekeyPath:     "./testdata/id_rsa",
+			PrivatekeyPassword: "test",
+		},
+	}
+	sha512Sig, err := signer.Sign([]byte("test"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// the same legacy ssh-rsa signature as TestSTNS_Verify
+	sha1Sig := []byte(`{"Format":"ssh-rsa","Blob":"YL0Elcvpcs2RfBMesMPmDiBI0ppwiPpdmwWDnOAEAzKvshWoBTPWhy7qE/VDwnwcTvbk9SyJovrAWPdOmPcnXuKtgQam4NorFWQWMRFI6/tL1C3JWjY/uuALD+bH0WUbmCvUCnCQ3s7tG6UNx0JDyP//bh2IV/B1tds24c2hd36MRpufknUbsD303welyxVcdGRKm0bi3hp+X/NFWHFo5TWe1qw+5mJpqR32flkflGXcHZkzRk+5hs3YbrM/Je5hEur55lCVz2pLv/zzF72nAyMxM3rpHJi8aNe5uI1ZuJW+GsK5SW3V7Wn1uJgfI5et7P7H2/i03EHgV8RGUR5bIMF+PC8dG4T9v5dJr/rZy8QfcQrVTcMioDcjB0BW/wE/JmAy3NvmOhkJb68Ec5FF7nisbpdGv+5UcH+3stSZR3g6mp1cYxNtTx+01AV1+ZIiC6dhh0lz+O81NrY+A98ldBdnXi7pDD/0B+UldDzkPZ/gqidSQLHKEFqJTEnPFud1","Rest":null}`)
+
+	tests := []struct {
+		name    string
+		opt     Options
+		sig     []byte
+		wantErr bool
+	}{
+		{
+			name: "permissive by default",
+			sig:  sha1Sig,
+		},
+		{
+			name: "allowed key type",
+			opt:  Options{AllowedKeyTypes: []string{ssh.KeyAlgoED25519, ssh.KeyAlgoRSA}},
+			sig:  sha512Sig,
+		},
+		{
+			name:    "disallowed key type",
+			opt:     Options{AllowedKeyTypes: []string{ssh.KeyAlgoED25519}},
+			sig:     sha512Sig,
+			wantErr: true,
+		},
+		{
+			name: "rsa key large enough",
+			opt:  Options{MinRSAKeySize: 3072},
+			sig:  sha512Sig,
+		},
+		{
+			name:    "rsa key too small",
+			opt:     Options{MinRSAKeySize: 4096},
+			sig:     sha512Sig,
+			wantErr: true,
+		},
+		{
+			name: "allowed signature format",
+			opt:  Options{AllowedSignatureFormats: []string{ssh.KeyAlgoRSASHA256, ssh.KeyAlgoRSASHA512}},
+			sig:  sha512Sig,
+		},
+		{
+			name:    "sha1 signature",
+			opt:     Options{AllowedSignatureFormats: []string{ssh.KeyAlgoRSASHA256, ssh.KeyAlgoRSASHA512}},
+			sig:     sha1Sig,
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			opt := tt.opt
+			c := &STNS{opt: &opt}
+
+			err := c.Verify([]byte("test"), pub, tt.sig)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("STNS.Verify() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if tt.wantErr && !errors.Is(err, ErrKeyPolicy) {
+				t.Errorf("STNS.Verify() error = %v, want %v", err, ErrKeyPolicy)
+			}
+		})
+	}
+}
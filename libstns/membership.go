@@ -0,0 +1,165 @@
+package libstns
+
+import (
+	"context"
+
+	"github.com/STNS/STNS/v2/model"
+)
+
+const userListKey = "user/list"
+const groupListKey = "group/list"
+
+func (s *STNS) GroupsForUser(name string) ([]*model.Group, error) {
+	return s.GroupsForUserContext(context.Background(), name)
+}
+
+// GroupsForUserContext returns the primary group of the user followed by
+// every group that lists the user as a member.
+func (s *STNS) GroupsForUserContext(ctx context.Context, name string) ([]*model.Group, error) {
+	user, err := s.GetUserByNameContext(ctx, name)
+	if err != nil {
+		return nil, err
+	}
+
+	groups, err := s.listGroupCached(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	ret := []*model.Group{}
+	var primary *model.Group
+	for _, g := range groups {
+		if g.ID == user.GroupID {
+			primary = g
+			break
+		}
+	}
+
+	if primary == nil {
+		g, err := s.GetGroupByIDContext(ctx, user.GroupID)
+		if err != nil && err != ErrGroupNotFound {
+			return nil, err
+		}
+		primary = g
+	}
+
+	if primary != nil {
+		ret = append(ret, primary)
+	}
+
+	for _, g := range groups {
+		if g.ID == user.GroupID {
+			continue
+		}
+		for _, u := range g.Users {
+			if u == user.Name {
+				ret = append(ret, g)
+				break
+			}
+		}
+	}
+	return ret, nil
+}
+
+func (s *STNS) IsMember(user, group string) (bool, error) {
+	return s.IsMemberContext(context.Background(), user, group)
+}
+
+// IsMemberContext reports whether the user belongs to the group, either as
+// its primary group or as a listed member.
+func (s *STNS) IsMemberContext(ctx context.Context, user, group string) (bool, error) {
+	if err := ValidateName(group); err != nil {
+		return false, err
+	}
+
+	groups, err := s.GroupsForUserContext(ctx, user)
+	if err != nil {
+		return false, err
+	}
+
+	for _, g := range groups {
+		if g.Name == group {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+func (s *STNS) MembersOfGroup(group string) ([]string, error) {
+	return s.MembersOfGroupContext(context.Background(), group)
+}
+
+// MembersOfGroupContext returns the names of the listed members of the group
+// merged with the users whose primary group it is.
+func (s *STNS) MembersOfGroupContext(ctx context.Context, group string) ([]string, error) {
+	g, err := s.GetGroupByNameContext(ctx, group)
+	if err != nil {
+		return nil, err
+	}
+
+	users, err := s.listUserCached(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	seen := map[string]bool{}
+	ret := []string{}
+	for _, u := range g.Users {
+		if !seen[u] {
+			seen[u] = true
+			ret = append(ret, u)
+		}
+	}
+
+	for _, u := range users {
+		if u.GroupID == g.ID && !seen[u.Name] {
+			seen[u.Name] = true
+			ret = append(ret, u.Name)
+		}
+	}
+	return ret, nil
+}
+
+func (s *STNS) listUserCached(ctx context.Context) ([]*model.User, error) {
+	if s.cache != nil {
+		if v, ok := s.cache.get(userListKey); ok && v != nil {
+			return v.([]*model.User), nil
+		}
+	}
+
+	ctx, info := WithResponseInfo(ctx)
+	users, err := s.ListUserContext(ctx)
+	if err != nil {
+		if isNotFound(err) {
+			return []*model.User{}, nil
+		}
+		return nil, err
+	}
+
+	if s.cache != nil && !info.Stale() {
+		s.cache.set(userListKey, users)
+	}
+	return users, nil
+}
+
+func (s *STNS) listGroupCached(ctx context.Context) ([]*model.Group, error) {
+	if s.cache != nil {
+		if v, ok := s.cache.get(groupListKey); ok && v != nil {
+			return v.([]*model.Group), nil
+		}
+	}
+
+	ctx, info := WithResponseInfo(ctx)
+	groups, err := s.ListGroupContext(ctx)
+	if err != nil {
+		if isNotFound(err) {
+			return []*model.Group{}, nil
+		}
+		return nil, err
+	}
+
+	if s.cache != nil && !info.Stale() {
+		s.cache.set(groupListKey, groups)
+	}
+	return groups, nil
+}
@@ -0,0 +1,162 @@
+package libstns
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"sync/atomic"
+	"testing"
+
+	"github.com/STNS/STNS/v2/model"
+)
+
+func newMembershipServer(t *testing.T, requests *int32) *httptest.Server {
+	users := []*model.User{
+		{Base: model.Base{ID: 1, Name: "alice"}, GroupID: 10},
+		{Base: model.Base{ID: 2, Name: "bob"}, GroupID: 20},
+		{Base: model.Base{ID: 3, Name: "carol"}, GroupID: 10},
+	}
+	groups := []*model.Group{
+		{Base: model.Base{ID: 10, Name: "dev"}, Users: []string{"bob"}},
+		{Base: model.Base{ID: 20, Name: "ops"}},
+		{Base: model.Base{ID: 30, Name: "sre"}, Users: []string{"alice", "bob"}},
+	}
+
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(requests, 1)
+		var v interface{}
+		switch r.URL.Path {
+		case "/users":
+			ret := []*model.User{}
+			for _, u := range users {
+				if r.FormValue("name") == "" || r.FormValue("name") == u.Name {
+					ret = append(ret, u)
+				}
+			}
+			v = ret
+		case "/groups":
+			ret := []*model.Group{}
+			for _, g := range groups {
+				if (r.FormValue("name") == "" || r.FormValue("name") == g.Name) &&
+					(r.FormValue("id") == "" || r.FormValue("id") == fmt.Sprint(g.ID)) {
+					ret = append(ret, g)
+				}
+			}
+			v = ret
+		}
+		rp, err := json.Marshal(v)
+		if err != nil {
+			t.Error(err)
+		}
+		fmt.Fprint(w, string(rp))
+	}))
+}
+
+func groupNames(groups []*model.Group) []string {
+	ret := []string{}
+	for _, g := range groups {
+		ret = append(ret, g.Name)
+	}
+	return ret
+}
+
+func TestSTNS_GroupsForUser(t *testing.T) {
+	var requests int32
+	ts := newMembershipServer(t, &requests)
+	defer ts.Close()
+
+	s, err := NewSTNS(ts.URL, &Options{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		user string
+		want []string
+	}{
+		{user: "alice", want: []string{"dev", "sre"}},
+		{user: "bob", want: []string{"ops", "dev", "sre"}},
+		{user: "carol", want: []string{"dev"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.user, func(t *testing.T) {
+			got, err := s.GroupsForUser(tt.user)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(groupNames(got), tt.want) {
+				t.Errorf("STNS.GroupsForUser() = %v, want %v", groupNames(got), tt.want)
+			}
+		})
+	}
+}
+
+func TestSTNS_IsMember(t *testing.T) {
+	var requests int32
+	ts := newMembershipServer(t, &requests)
+	defer ts.Close()
+
+	s, err := NewSTNS(ts.URL, &Options{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		user  string
+		group string
+		want  bool
+	}{
+		{user: "alice", group: "dev", want: true},
+		{user: "alice", group: "sre", want: true},
+		{user: "alice", group: "ops", want: false},
+		{user: "carol", group: "sre", want: false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.user+"/"+tt.group, func(t *testing.T) {
+			got, err := s.IsMember(tt.user, tt.group)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got != tt.want {
+				t.Errorf("STNS.IsMember() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestSTNS_MembersOfGroup(t *testing.T) {
+	var requests int32
+	ts := newMembershipServer(t, &requests)
+	defer ts.Close()
+
+	s, err := NewSTNS(ts.URL, &Options{Cache: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		group string
+		want  []string
+	}{
+		{group: "dev", want: []string{"bob", "alice", "carol"}},
+		{group: "ops", want: []string{"bob"}},
+		{group: "sre", want: []string{"alice", "bob"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.group, func(t *testing.T) {
+			got, err := s.MembersOfGroup(tt.group)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("STNS.MembersOfGroup() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+
+	if n := atomic.LoadInt32(&requests); n != 4 {
+		t.Errorf("requests = %d, want 4", n)
+	}
+}
@@ -0,0 +1,46 @@
+package libstns
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+)
+
+const maxNameLength = 255
+
+var ErrInvalidName = errors.New("invalid name")
+
+var namePattern = regexp.MustCompile(`^[A-Za-z0-9_][A-Za-z0-9_.@-]*\$?$`)
+var numericPattern = regexp.MustCompile(`^[0-9]+$`)
+
+// InvalidNameError is returned when a user or group name does not follow
+// the STNS naming rules. It matches ErrInvalidName with errors.Is.
+type InvalidNameError struct {
+	Name   string
+	Reason string
+}
+
+func (e *InvalidNameError) Error() string {
+	return fmt.Sprintf("invalid name %q: %s", e.Name, e.Reason)
+}
+
+func (e *InvalidNameError) Unwrap() error {
+	return ErrInvalidName
+}
+
+// ValidateName checks that name is a valid user or group name: letters,
+// digits, '_', '.', '@' and '-', not starting with '.', '@' or '-', an
+// optional trailing '$', not entirely numeric and at most 255 bytes.
+func ValidateName(name string) error {
+	switch {
+	case name == "":
+		return &InvalidNameError{Name: name, Reason: "empty"}
+	case len(name) > maxNameLength:
+		return &InvalidNameError{Name: name, Reason: fmt.Sprintf("longer than %d bytes", maxNameLength)}
+	case numericPattern.MatchString(name):
+		return &InvalidNameError{Name: name, Reason: "numeric"}
+	case !namePattern.MatchString(name):
+		return &InvalidNameError{Name: name, Reason: "contains invalid characters"}
+	}
+	return nil
+}
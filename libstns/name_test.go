@@ -0,0 +1,73 @@
+package libstns
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+)
+
+func TestValidateName(t *testing.T) {
+	tests := []struct {
+		name    string
+		arg     string
+		wantErr bool
+	}{
+		{name: "simple", arg: "example1"},
+		{name: "with symbols", arg: "ex_am.ple-1@example"},
+		{name: "machine account", arg: "host01$"},
+		{name: "leading digit", arg: "1example"},
+		{name: "empty", arg: "", wantErr: true},
+		{name: "numeric", arg: "1000", wantErr: true},
+		{name: "ampersand", arg: "example&id=1", wantErr: true},
+		{name: "hash", arg: "example#", wantErr: true},
+		{name: "space", arg: "example 1", wantErr: true},
+		{name: "path traversal", arg: "../../etc/foo", wantErr: true},
+		{name: "leading hyphen", arg: "-example", wantErr: true},
+		{name: "too long", arg: strings.Repeat("a", maxNameLength+1), wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := ValidateName(tt.arg)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("ValidateName() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if err == nil {
+				return
+			}
+
+			var ne *InvalidNameError
+			if !errors.As(err, &ne) || !errors.Is(err, ErrInvalidName) || ne.Name != tt.arg {
+				t.Errorf("ValidateName() error = %#v, want *InvalidNameError", err)
+			}
+		})
+	}
+}
+
+func TestSTNS_GetByNameInvalidName(t *testing.T) {
+	var requests int32
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&requests, 1)
+	}))
+	defer ts.Close()
+
+	s, err := NewSTNS(ts.URL, &Options{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := s.GetUserByName("example&id=1"); !errors.Is(err, ErrInvalidName) {
+		t.Errorf("STNS.GetUserByName() error = %v, want %v", err, ErrInvalidName)
+	}
+	if _, err := s.GetGroupByName("example group"); !errors.Is(err, ErrInvalidName) {
+		t.Errorf("STNS.GetGroupByName() error = %v, want %v", err, ErrInvalidName)
+	}
+	if _, err := s.CreateUserChallengeCode("../../etc/foo"); !errors.Is(err, ErrInvalidName) {
+		t.Errorf("STNS.CreateUserChallengeCode() error = %v, want %v", err, ErrInvalidName)
+	}
+	if n := atomic.LoadInt32(&requests); n != 0 {
+		t.Errorf("requests = %d, want 0", n)
+	}
+}
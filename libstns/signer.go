@@ -0,0 +1,70 @@
+package libstns
+
+import (
+	"crypto"
+
+	"github.com/sirupsen/logrus"
+	"golang.org/x/crypto/ssh"
+)
+
+// SetSigner makes Sign use s instead of ssh-agent or the key file. Passing
+// nil restores the default behaviour.
+func (c *STNS) SetSigner(s ssh.Signer) {
+	c.signerMu.Lock()
+	defer c.signerMu.Unlock()
+	c.customSigner = s
+}
+
+// SetCryptoSigner is like SetSigner for a crypto.Signer, such as a key held
+// by a KMS or an HSM.
+func (c *STNS) SetCryptoSigner(s crypto.Signer) error {
+	signer, err := ssh.NewSignerFromSigner(s)
+	if err != nil {
+		return err
+	}
+	c.SetSigner(signer)
+	return nil
+}
+
+// signer returns the signer used by Sign and a function releasing it. A
+// signer set by SetSigner takes precedence, then ssh-agent when
+// Options.SSHAgent is set, then the key file.
+func (c *STNS) signer() (ssh.Signer, func(), error) {
+	c.signerMu.Lock()
+	s := c.customSigner
+	c.signerMu.Unlock()
+	if s != nil {
+		return s, func() {}, nil
+	}
+
+	if c.opt.SSHAgent {
+		s, closer, err := c.agentSigner()
+		if err == nil {
+			return s, closer, nil
+		}
+		logrus.Warnf("ssh-agent signer unavailable, fall back to key file:%s", err.Error())
+	}
+
+	s, err := c.cachedFileSigner()
+	if err != nil {
+		return nil, nil, err
+	}
+	return s, func() {}, nil
+}
+
+// cachedFileSigner loads the key file once and reuses the parsed key.
+func (c *STNS) cachedFileSigner() (ssh.Signer, error) {
+	c.signerMu.Lock()
+	defer c.signerMu.Unlock()
+
+	if c.fileSigner != nil {
+		return c.fileSigner, nil
+	}
+
+	s, err := c.loadPrivateKey()
+	if err != nil {
+		return nil, err
+	}
+	c.fileSigner = s
+	return s, nil
+}
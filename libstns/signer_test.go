@@ -0,0 +1,91 @@
+package libstns
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"golang.org/x/crypto/ssh"
+)
+
+func TestSTNS_SetCryptoSigner(t *testing.T) {
+	pub, priv, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	sshPub, err := ssh.NewPublicKey(pub)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	c := &STNS{
+		opt: &Options{
+			PrivatekeyPath: "./testdata/missing",
+		},
+	}
+	if err := c.SetCryptoSigner(priv); err != nil {
+		t.Fatal(err)
+	}
+
+	got, err := c.Sign([]byte("test"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := c.Verify([]byte("test"), ssh.MarshalAuthorizedKey(sshPub), got); err != nil {
+		t.Errorf("STNS.Verify() error = %v", err)
+	}
+
+	c.SetSigner(nil)
+	if _, err := c.Sign([]byte("test")); err == nil {
+		t.Error("STNS.Sign() want error after the signer is cleared")
+	}
+}
+
+func TestSTNS_SignCachesKeyFile(t *testing.T) {
+	b, err := ioutil.ReadFile("./testdata/id_rsa")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	path := filepath.Join(t.TempDir(), "id_rsa")
+	if err := ioutil.WriteFile(path, b, 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	c := &STNS{
+		opt: &Options{
+			PrivatekeyPath:     path,
+			PrivatekeyPassword: "test",
+		},
+	}
+	if _, err := c.Sign([]byte("test")); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := os.Remove(path); err != nil {
+		t.Fatal(err)
+	}
+
+	got, err := c.Sign([]byte("test"))
+	if err != nil {
+		t.Fatalf("STNS.Sign() error = %v, want the cached key", err)
+	}
+
+	var sig ssh.Signature
+	if err := json.Unmarshal(got, &sig); err != nil {
+		t.Fatal(err)
+	}
+
+	pub, err := ioutil.ReadFile("./testdata/id_rsa.pub")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := c.Verify([]byte("test"), pub, got); err != nil {
+		t.Errorf("STNS.Verify() error = %v", err)
+	}
+}
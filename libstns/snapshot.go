@@ -0,0 +1,208 @@
+package libstns
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/STNS/STNS/v2/model"
+	"github.com/sirupsen/logrus"
+)
+
+const snapshotVersion = 1
+const snapshotFileName = "snapshot.json"
+
+var (
+	ErrSnapshotCorrupted = errors.New("snapshot corrupted")
+	ErrSnapshotStale     = errors.New("snapshot source is stale")
+)
+
+// Snapshot is a copy of every user and group that can be persisted to disk
+// and used to resolve accounts while the STNS server is unreachable.
+type Snapshot struct {
+	CreatedAt time.Time      `json:"created_at"`
+	Users     []*model.User  `json:"users"`
+	Groups    []*model.Group `json:"groups"`
+}
+
+type snapshotFile struct {
+	Version  int             `json:"version"`
+	Checksum string          `json:"checksum"`
+	Payload  json.RawMessage `json:"payload"`
+}
+
+func (s *STNS) SaveSnapshot(dir string) error {
+	return s.SaveSnapshotContext(context.Background(), dir)
+}
+
+// SaveSnapshotContext fetches every user and group and atomically writes
+// them to dir. Nothing is written if either list was served stale, so an
+// outage never makes old data look fresh.
+func (s *STNS) SaveSnapshotContext(ctx context.Context, dir string) error {
+	ctx, info := WithResponseInfo(ctx)
+	users, err := s.ListUserContext(ctx)
+	if err != nil {
+		return err
+	}
+
+	groups, err := s.ListGroupContext(ctx)
+	if err != nil {
+		return err
+	}
+
+	if info.Stale() {
+		return ErrSnapshotStale
+	}
+
+	return WriteSnapshot(dir, &Snapshot{
+		CreatedAt: time.Now(),
+		Users:     users,
+		Groups:    groups,
+	})
+}
+
+// LoadSnapshot reads the snapshot in dir and uses it as a fallback when the
+// STNS server is unreachable. Loaded entries are never cached, so they are
+// only served while the server is unavailable.
+func (s *STNS) LoadSnapshot(dir string) (*Snapshot, error) {
+	ss, err := ReadSnapshot(dir)
+	if err != nil {
+		return nil, err
+	}
+
+	s.snapshotMu.Lock()
+	s.snapshot = ss
+	s.snapshotMu.Unlock()
+	return ss, nil
+}
+
+func WriteSnapshot(dir string, ss *Snapshot) error {
+	payload, err := json.Marshal(ss)
+	if err != nil {
+		return err
+	}
+
+	sum := sha256.Sum256(payload)
+	b, err := json.Marshal(&snapshotFile{
+		Version:  snapshotVersion,
+		Checksum: hex.EncodeToString(sum[:]),
+		Payload:  payload,
+	})
+	if err != nil {
+		return err
+	}
+
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return err
+	}
+
+	f, err := ioutil.TempFile(dir, ".snapshot-")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(f.Name())
+
+	if err := f.Chmod(0600); err != nil {
+		f.Close()
+		return err
+	}
+
+	if _, err := f.Write(b); err != nil {
+		f.Close()
+		return err
+	}
+
+	if err := f.Sync(); err != nil {
+		f.Close()
+		return err
+	}
+
+	if err := f.Close(); err != nil {
+		return err
+	}
+
+	if err := os.Rename(f.Name(), filepath.Join(dir, snapshotFileName)); err != nil {
+		return err
+	}
+
+	d, err := os.Open(dir)
+	if err != nil {
+		return err
+	}
+	defer d.Close()
+	return d.Sync()
+}
+
+func ReadSnapshot(dir string) (*Snapshot, error) {
+	b, err := ioutil.ReadFile(filepath.Join(dir, snapshotFileName))
+	if err != nil {
+		return nil, err
+	}
+
+	var sf snapshotFile
+	if err := json.Unmarshal(b, &sf); err != nil {
+		return nil, fmt.Errorf("%w: %s", ErrSnapshotCorrupted, err.Error())
+	}
+
+	if sf.Version != snapshotVersion {
+		return nil, fmt.Errorf("%w: unsupported version %d", ErrSnapshotCorrupted, sf.Version)
+	}
+
+	sum := sha256.Sum256(sf.Payload)
+	if hex.EncodeToString(sum[:]) != sf.Checksum {
+		return nil, fmt.Errorf("%w: checksum mismatch", ErrSnapshotCorrupted)
+	}
+
+	var ss Snapshot
+	if err := json.Unmarshal(sf.Payload, &ss); err != nil {
+		return nil, fmt.Errorf("%w: %s", ErrSnapshotCorrupted, err.Error())
+	}
+	return &ss, nil
+}
+
+func (s *STNS) loadSnapshotOnStartup() {
+	if s.opt.SnapshotDir == "" {
+		return
+	}
+
+	if _, err := s.LoadSnapshot(s.opt.SnapshotDir); err != nil && !os.IsNotExist(err) {
+		logrus.Warnf("load snapshot error:%s", err.Error())
+	}
+}
+
+func (s *STNS) snapshotUsers(ctx context.Context, err error) []*model.User {
+	if !isUnavailable(ctx, err) {
+		return nil
+	}
+
+	s.snapshotMu.RLock()
+	defer s.snapshotMu.RUnlock()
+
+	if s.snapshot == nil {
+		return nil
+	}
+	markStale(ctx)
+	return s.snapshot.Users
+}
+
+func (s *STNS) snapshotGroups(ctx context.Context, err error) []*model.Group {
+	if !isUnavailable(ctx, err) {
+		return nil
+	}
+
+	s.snapshotMu.RLock()
+	defer s.snapshotMu.RUnlock()
+
+	if s.snapshot == nil {
+		return nil
+	}
+	markStale(ctx)
+	return s.snapshot.Groups
+}
@@ -0,0 +1,171 @@
+package libstns
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/STNS/STNS/v2/model"
+)
+
+func TestSTNS_Snapshot(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var v interface{}
+		switch r.URL.Path {
+		case "/users":
+			v = []*model.User{{Base: model.Base{ID: 1, Name: "example1"}, GroupID: 10}}
+		case "/groups":
+			v = []*model.Group{{Base: model.Base{ID: 10, Name: "group1"}}}
+		}
+		rp, err := json.Marshal(v)
+		if err != nil {
+			t.Error(err)
+		}
+		fmt.Fprint(w, string(rp))
+	}))
+
+	dir := filepath.Join(t.TempDir(), "snapshot")
+	s, err := NewSTNS(ts.URL, &Options{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := s.SaveSnapshot(dir); err != nil {
+		t.Fatal(err)
+	}
+	ts.Close()
+
+	fi, err := os.Stat(filepath.Join(dir, snapshotFileName))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if fi.Mode().Perm() != 0600 {
+		t.Errorf("snapshot mode = %o, want 0600", fi.Mode().Perm())
+	}
+
+	s, err = NewSTNS(ts.URL, &Options{SnapshotDir: dir})
+	if err != nil {
+		t.Fatal(err)
+	}
+	withoutRetryWait(s.client)
+
+	if u, err := s.GetUserByName("example1"); err != nil || u.ID != 1 {
+		t.Errorf("STNS.GetUserByName() = %v, %v", u, err)
+	}
+	if _, err := s.GetUserByName("example2"); !errors.Is(err, ErrUserNotFound) {
+		t.Errorf("STNS.GetUserByName() error = %v, want %v", err, ErrUserNotFound)
+	}
+	if g, err := s.GetGroupByID(10); err != nil || g.Name != "group1" {
+		t.Errorf("STNS.GetGroupByID() = %v, %v", g, err)
+	}
+	if gs, err := s.ListGroup(); err != nil || len(gs) != 1 {
+		t.Errorf("STNS.ListGroup() = %v, %v", gs, err)
+	}
+}
+
+func TestReadSnapshot(t *testing.T) {
+	dir := t.TempDir()
+	if err := WriteSnapshot(dir, &Snapshot{
+		Users: []*model.User{{Base: model.Base{ID: 1, Name: "example1"}}},
+	}); err != nil {
+		t.Fatal(err)
+	}
+
+	ss, err := ReadSnapshot(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(ss.Users) != 1 || ss.Users[0].Name != "example1" {
+		t.Errorf("ReadSnapshot() = %v", ss)
+	}
+
+	p := filepath.Join(dir, snapshotFileName)
+	b, err := ioutil.ReadFile(p)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var sf snapshotFile
+	if err := json.Unmarshal(b, &sf); err != nil {
+		t.Fatal(err)
+	}
+	sf.Payload = json.RawMessage(`{"users":[{"id":0,"name":"root"}]}`)
+	b, err = json.Marshal(sf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(p, b, 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := ReadSnapshot(dir); !errors.Is(err, ErrSnapshotCorrupted) {
+		t.Errorf("ReadSnapshot() error = %v, want %v", err, ErrSnapshotCorrupted)
+	}
+}
+
+func TestSTNS_SnapshotOnlyWhenUnavailable(t *testing.T) {
+	dir := t.TempDir()
+	if err := WriteSnapshot(dir, &Snapshot{
+		Users: []*model.User{{Base: model.Base{ID: 1, Name: "deleted"}}},
+	}); err != nil {
+		t.Fatal(err)
+	}
+
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusNotFound)
+	}))
+	defer ts.Close()
+
+	s, err := NewSTNS(ts.URL, &Options{SnapshotDir: dir, Cache: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := s.GetUserByName("deleted"); !errors.Is(err, ErrUserNotFound) {
+		t.Errorf("STNS.GetUserByName() error = %v, want %v", err, ErrUserNotFound)
+	}
+
+	ts.Close()
+	withoutRetryWait(s.client)
+	s.PurgeCache()
+
+	ctx, info := WithResponseInfo(context.Background())
+	if u, err := s.GetUserByNameContext(ctx, "deleted"); err != nil || u.ID != 1 || !info.Stale() {
+		t.Errorf("STNS.GetUserByNameContext() = %v, %v stale = %v, want stale snapshot user", u, err, info.Stale())
+	}
+	if stats := s.CacheStats(); stats.Entries != 0 {
+		t.Errorf("STNS.CacheStats().Entries = %d, want snapshot results not cached", stats.Entries)
+	}
+}
+
+func TestSTNS_SaveSnapshotStale(t *testing.T) {
+	src := t.TempDir()
+	if err := WriteSnapshot(src, &Snapshot{
+		Users:  []*model.User{{Base: model.Base{ID: 1, Name: "example1"}}},
+		Groups: []*model.Group{{Base: model.Base{ID: 10, Name: "group1"}}},
+	}); err != nil {
+		t.Fatal(err)
+	}
+
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	ts.Close()
+
+	s, err := NewSTNS(ts.URL, &Options{SnapshotDir: src})
+	if err != nil {
+		t.Fatal(err)
+	}
+	withoutRetryWait(s.client)
+
+	dir := filepath.Join(t.TempDir(), "snapshot")
+	if err := s.SaveSnapshot(dir); !errors.Is(err, ErrSnapshotStale) {
+		t.Errorf("STNS.SaveSnapshot() error = %v, want %v", err, ErrSnapshotStale)
+	}
+	if _, err := os.Stat(filepath.Join(dir, snapshotFileName)); !os.IsNotExist(err) {
+		t.Errorf("snapshot error = %v, want not written", err)
+	}
+}
@@ -0,0 +1,216 @@
+package libstns
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"crypto/sha512"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"strings"
+
+	"golang.org/x/crypto/ssh"
+)
+
+const (
+	SignatureFormatJSON   = "json"
+	SignatureFormatSSHSIG = "sshsig"
+)
+
+var DefaultSignatureNamespace = "stns"
+
+var ErrInvalidSSHSIG = errors.New("invalid ssh signature")
+
+const (
+	sshsigMagic       = "SSHSIG"
+	sshsigVersion     = 1
+	sshsigBeginMarker = "-----BEGIN SSH SIGNATURE-----"
+	sshsigEndMarker   = "-----END SSH SIGNATURE-----"
+	sshsigLineLength  = 70
+)
+
+type sshsigBlob struct {
+	Version       uint32
+	PublicKey     []byte
+	Namespace     string
+	Reserved      string
+	HashAlgorithm string
+	Signature     []byte
+}
+
+type sshsigSignedData struct {
+	Namespace     string
+	Reserved      string
+	HashAlgorithm string
+	Hash          []byte
+}
+
+// SignSSHSIG signs msg in the armored format produced by
+// `ssh-keygen -Y sign -n namespace`.
+func SignSSHSIG(signer ssh.Signer, msg []byte, namespace string) ([]byte, error) {
+	if namespace == "" {
+		return nil, fmt.Errorf("%w: namespace is required", ErrInvalidSSHSIG)
+	}
+
+	h := sha512.Sum512(msg)
+	data := sshsigData(namespace, "sha512", h[:])
+
+	sig, err := signData(signer, data)
+	if err != nil {
+		return nil, err
+	}
+
+	blob := append([]byte(sshsigMagic), ssh.Marshal(&sshsigBlob{
+		Version:       sshsigVersion,
+		PublicKey:     signer.PublicKey().Marshal(),
+		Namespace:     namespace,
+		HashAlgorithm: "sha512",
+		Signature:     ssh.Marshal(sig),
+	})...)
+
+	return armorSSHSIG(blob), nil
+}
+
+// VerifySSHSIG checks an armored signature over msg in the given namespace
+// and returns the public key that made it. The caller must check that the
+// key is one it trusts.
+func VerifySSHSIG(msg, armored []byte, namespace string) (ssh.PublicKey, error) {
+	b, publicKey, err := parseSSHSIG(armored)
+	if err != nil {
+		return nil, err
+	}
+
+	if b.Namespace != namespace {
+		return nil, fmt.Errorf("%w: namespace %q does not match %q", ErrInvalidSSHSIG, b.Namespace, namespace)
+	}
+
+	var h []byte
+	switch b.HashAlgorithm {
+	case "sha256":
+		s := sha256.Sum256(msg)
+		h = s[:]
+	case "sha512":
+		s := sha512.Sum512(msg)
+		h = s[:]
+	default:
+		return nil, fmt.Errorf("%w: unsupported hash algorithm %s", ErrInvalidSSHSIG, b.HashAlgorithm)
+	}
+
+	var sig ssh.Signature
+	if err := ssh.Unmarshal(b.Signature, &sig); err != nil {
+		return nil, fmt.Errorf("%w: %s", ErrInvalidSSHSIG, err.Error())
+	}
+
+	// Like ssh-keygen, refuse RSA signatures made with SHA-1.
+	if isRSAKey(publicKey) && sig.Format == ssh.KeyAlgoRSA {
+		return nil, fmt.Errorf("%w: rsa signature uses sha1", ErrInvalidSSHSIG)
+	}
+
+	if err := publicKey.Verify(sshsigData(b.Namespace, b.HashAlgorithm, h), &sig); err != nil {
+		return nil, ErrVerifyFailed
+	}
+	return publicKey, nil
+}
+
+// parseSSHSIG decodes an armored signature without verifying it.
+func parseSSHSIG(armored []byte) (*sshsigBlob, ssh.PublicKey, error) {
+	blob, err := dearmorSSHSIG(armored)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	if !bytes.HasPrefix(blob, []byte(sshsigMagic)) {
+		return nil, nil, fmt.Errorf("%w: bad magic", ErrInvalidSSHSIG)
+	}
+
+	var b sshsigBlob
+	if err := ssh.Unmarshal(blob[len(sshsigMagic):], &b); err != nil {
+		return nil, nil, fmt.Errorf("%w: %s", ErrInvalidSSHSIG, err.Error())
+	}
+
+	if b.Version != sshsigVersion {
+		return nil, nil, fmt.Errorf("%w: unsupported version %d", ErrInvalidSSHSIG, b.Version)
+	}
+
+	publicKey, err := ssh.ParsePublicKey(b.PublicKey)
+	if err != nil {
+		return nil, nil, fmt.Errorf("%w: %s", ErrInvalidSSHSIG, err.Error())
+	}
+	return &b, publicKey, nil
+}
+
+// sshsigFormat returns the format of the signature inside an SSHSIG
+// signature, such as rsa-sha2-512.
+func sshsigFormat(armored []byte) (string, error) {
+	b, _, err := parseSSHSIG(armored)
+	if err != nil {
+		return "", err
+	}
+
+	var sig ssh.Signature
+	if err := ssh.Unmarshal(b.Signature, &sig); err != nil {
+		return "", fmt.Errorf("%w: %s", ErrInvalidSSHSIG, err.Error())
+	}
+	return sig.Format, nil
+}
+
+func isRSAKey(publicKey ssh.PublicKey) bool {
+	if cert, ok := publicKey.(*ssh.Certificate); ok {
+		publicKey = cert.Key
+	}
+	return publicKey.Type() == ssh.KeyAlgoRSA
+}
+
+func isSSHSIG(signature []byte) bool {
+	return bytes.HasPrefix(bytes.TrimSpace(signature), []byte(sshsigBeginMarker))
+}
+
+func sshsigData(namespace, hashAlgorithm string, h []byte) []byte {
+	return append([]byte(sshsigMagic), ssh.Marshal(&sshsigSignedData{
+		Namespace:     namespace,
+		HashAlgorithm: hashAlgorithm,
+		Hash:          h,
+	})...)
+}
+
+func armorSSHSIG(blob []byte) []byte {
+	enc := base64.StdEncoding.EncodeToString(blob)
+
+	var buf bytes.Buffer
+	buf.WriteString(sshsigBeginMarker + "\n")
+	for len(enc) > sshsigLineLength {
+		buf.WriteString(enc[:sshsigLineLength] + "\n")
+		enc = enc[sshsigLineLength:]
+	}
+	buf.WriteString(enc + "\n")
+	buf.WriteString(sshsigEndMarker + "\n")
+	return buf.Bytes()
+}
+
+func dearmorSSHSIG(armored []byte) ([]byte, error) {
+	s := strings.TrimSpace(string(armored))
+	if !strings.HasPrefix(s, sshsigBeginMarker) || !strings.HasSuffix(s, sshsigEndMarker) {
+		return nil, fmt.Errorf("%w: missing armor", ErrInvalidSSHSIG)
+	}
+
+	s = strings.TrimSuffix(strings.TrimPrefix(s, sshsigBeginMarker), sshsigEndMarker)
+	blob, err := base64.StdEncoding.DecodeString(strings.Join(strings.Fields(s), ""))
+	if err != nil {
+		return nil, fmt.Errorf("%w: %s", ErrInvalidSSHSIG, err.Error())
+	}
+	return blob, nil
+}
+
+func (c *STNS) signatureFormat() string {
+	if c.opt == nil || c.opt.SignatureFormat == "" {
+		return SignatureFormatJSON
+	}
+	return c.opt.SignatureFormat
+}
+
+func (c *STNS) signatureNamespace() string {
+	if c.opt == nil || c.opt.SignatureNamespace == "" {
+		return DefaultSignatureNamespace
+	}
+	return c.opt.SignatureNamespace
+}
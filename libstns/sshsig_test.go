@@ -0,0 +1,129 @@
+package libstns
+
+import (
+	"errors"
+	"io/ioutil"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestSTNS_VerifySSHSIG(t *testing.T) {
+	pub, err := ioutil.ReadFile("./testdata/id_rsa.pub")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// generated by `ssh-keygen -Y sign -f testdata/id_rsa -n stns`
+	sig, err := ioutil.ReadFile("./testdata/test.sshsig")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	other := []byte("ssh-rsa AAAAB3NzaC1yc2EAAAADAQABAAABgQCwayeIUERUKcKX4PYJpBRN6Sd7QpecD026HFJiiOi6UlEEEKcgPykB5+UVYXaU+jCJK/b5+pPqWXm848furoVL0qMxR/k+tBH9jMZgkeHumoM6YOQYOi6SvxC7Bqo4846DD63aHvaDLwixVGtJYRQBXlWD2AGJDSZVxeiJ8b72LnUdMhEhHs+GHAcXumxxlEl1XPBkVE8ncB10utcAxiQC9+DRKwrtwGwHnBQ2Zu6Ms9s2BkI6RxEDqqjGq2sqMiulvG68hLAhHPSwBnyBPfzQJCnP+xPqw1j+2Pl4hdseW4Lf0Kdet2tkf6fz93XAfdkr3nAUNOY8fJ3GZQ+xvV/Y2DkEPAocKKi4A3w0MonMLSO/aowArrJWNOCyaUOgpgvcb4d4rRWKF/fHq0SYkVGg7eKnTBPByqiB6KZfLSrE9flptzAfY5hokLx2tIEV5jsG0arzTks5j8uS+U/Om9UiFrymZNALoapiKH+SwbqQfi87oInHMSVsLxBtFyamhD0=")
+
+	tests := []struct {
+		name      string
+		namespace string
+		msg       []byte
+		keys      []byte
+		wantErr   error
+	}{
+		{
+			name: "ok",
+			msg:  []byte("test"),
+			keys: pub,
+		},
+		{
+			name: "second key",
+			msg:  []byte("test"),
+			keys: append(append(other, '\n'), pub...),
+		},
+		{
+			name:    "message unmatch",
+			msg:     []byte("tset"),
+			keys:    pub,
+			wantErr: ErrVerifyFailed,
+		},
+		{
+			name:    "key unmatch",
+			msg:     []byte("test"),
+			keys:    other,
+			wantErr: ErrVerifyFailed,
+		},
+		{
+			name:      "namespace unmatch",
+			namespace: "file",
+			msg:       []byte("test"),
+			keys:      pub,
+			wantErr:   ErrInvalidSSHSIG,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := &STNS{
+				opt: &Options{
+					SignatureNamespace: tt.namespace,
+				},
+			}
+			err := c.Verify(tt.msg, tt.keys, sig)
+			if tt.wantErr == nil && err != nil {
+				t.Errorf("STNS.Verify() error = %v", err)
+			}
+			if tt.wantErr != nil && !errors.Is(err, tt.wantErr) {
+				t.Errorf("STNS.Verify() error = %v, want %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestSTNS_SignSSHSIG(t *testing.T) {
+	c := &STNS{
+		opt: &Options{
+			PrivatekeyPath:     "./testdata/id_rsa",
+			PrivatekeyPassword: "test",
+			SignatureFormat:    SignatureFormatSSHSIG,
+		},
+	}
+
+	sig, err := c.Sign([]byte("test"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !strings.HasPrefix(string(sig), sshsigBeginMarker) {
+		t.Fatalf("STNS.Sign() = %s, want an armored signature", sig)
+	}
+
+	pub, err := ioutil.ReadFile("./testdata/id_rsa.pub")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := c.Verify([]byte("test"), pub, sig); err != nil {
+		t.Errorf("STNS.Verify() error = %v", err)
+	}
+
+	keygen, err := exec.LookPath("ssh-keygen")
+	if err != nil {
+		t.Skip("ssh-keygen not found")
+	}
+
+	dir := t.TempDir()
+	signers := filepath.Join(dir, "allowed_signers")
+	if err := ioutil.WriteFile(signers, append([]byte("example "), pub...), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	sigFile := filepath.Join(dir, "test.sig")
+	if err := ioutil.WriteFile(sigFile, sig, 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	cmd := exec.Command(keygen, "-Y", "verify", "-f", signers, "-I", "example", "-n", DefaultSignatureNamespace, "-s", sigFile)
+	cmd.Stdin = strings.NewReader("test")
+	if out, err := cmd.CombinedOutput(); err != nil {
+		t.Errorf("ssh-keygen -Y verify error = %v output = %s", err, out)
+	}
+}
@@ -0,0 +1,91 @@
+package libstns
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"sync/atomic"
+	"time"
+)
+
+var DefaultMaxStaleness = 86400
+
+// staleStore keeps the last successful response for each request so that
+// it can be served when the STNS server is unreachable. It holds at most
+// Options.CacheSize responses, evicting the least recently used.
+type staleStore struct {
+	entries *cache
+}
+
+func newStaleStore(opt *Options) *staleStore {
+	if opt.MaxStaleness == 0 {
+		opt.MaxStaleness = DefaultMaxStaleness
+	}
+
+	size := opt.CacheSize
+	if size == 0 {
+		size = DefaultCacheSize
+	}
+
+	maxStaleness := time.Duration(opt.MaxStaleness) * time.Second
+	return &staleStore{
+		entries: newLRUCache(maxStaleness, maxStaleness, size),
+	}
+}
+
+func (s *staleStore) store(key string, r *Response) {
+	s.entries.set(key, r)
+}
+
+func (s *staleStore) load(key string) *Response {
+	v, ok := s.entries.get(key)
+	if !ok {
+		return nil
+	}
+
+	r := *v.(*Response)
+	r.Stale = true
+	return &r
+}
+
+type responseInfoKey struct{}
+
+// ResponseInfo tells whether the data returned by calls made with the
+// context from WithResponseInfo was served stale, because the server was
+// unavailable.
+type ResponseInfo struct {
+	parent *ResponseInfo
+	stale  int32
+}
+
+func WithResponseInfo(ctx context.Context) (context.Context, *ResponseInfo) {
+	parent, _ := ctx.Value(responseInfoKey{}).(*ResponseInfo)
+	info := &ResponseInfo{parent: parent}
+	return context.WithValue(ctx, responseInfoKey{}, info), info
+}
+
+func (i *ResponseInfo) Stale() bool {
+	return atomic.LoadInt32(&i.stale) == 1
+}
+
+// markStale flags the ResponseInfo of ctx and of the contexts it was
+// derived from.
+func markStale(ctx context.Context) {
+	for i, _ := ctx.Value(responseInfoKey{}).(*ResponseInfo); i != nil; i = i.parent {
+		atomic.StoreInt32(&i.stale, 1)
+	}
+}
+
+// isUnavailable reports whether err means the server could not answer, as
+// opposed to the caller giving up or the server rejecting the request.
+func isUnavailable(ctx context.Context, err error) bool {
+	if err == nil || ctx.Err() != nil {
+		return false
+	}
+
+	var he *HTTPError
+	if errors.As(err, &he) {
+		return he.StatusCode >= http.StatusInternalServerError
+	}
+	return true
+}
@@ -0,0 +1,187 @@
+package libstns
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/hashicorp/go-retryablehttp"
+)
+
+func withoutRetryWait(h *client) *client {
+	for _, e := range h.endpoints {
+		rc := e.httpClient.Transport.(*retryablehttp.RoundTripper).Client
+		rc.RetryWaitMin = time.Millisecond
+		rc.RetryWaitMax = time.Millisecond
+	}
+	return h
+}
+
+func TestClient_RequestStaleIfError(t *testing.T) {
+	tests := []struct {
+		name         string
+		opt          *Options
+		responseCode int
+		sleep        time.Duration
+		wantStale    bool
+		wantErr      bool
+	}{
+		{
+			name:         "server error",
+			opt:          &Options{StaleIfError: true},
+			responseCode: http.StatusInternalServerError,
+			wantStale:    true,
+		},
+		{
+			name:         "client error",
+			opt:          &Options{StaleIfError: true},
+			responseCode: http.StatusForbidden,
+			wantErr:      true,
+		},
+		{
+			name:         "disabled",
+			opt:          &Options{},
+			responseCode: http.StatusInternalServerError,
+			wantErr:      true,
+		},
+		{
+			name:         "too stale",
+			opt:          &Options{StaleIfError: true, MaxStaleness: 1},
+			responseCode: http.StatusInternalServerError,
+			sleep:        1100 * time.Millisecond,
+			wantErr:      true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var down int32
+			ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				if atomic.LoadInt32(&down) == 1 {
+					w.WriteHeader(tt.responseCode)
+					return
+				}
+				fmt.Fprint(w, "it is ok")
+			}))
+			defer ts.Close()
+
+			h, err := newClient(ts.URL, tt.opt)
+			if err != nil {
+				t.Fatal(err)
+			}
+			withoutRetryWait(h)
+
+			if _, err := h.Request("test", ""); err != nil {
+				t.Fatal(err)
+			}
+			atomic.StoreInt32(&down, 1)
+			time.Sleep(tt.sleep)
+
+			got, err := h.Request("test", "")
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("Client.Request() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if tt.wantStale && (!got.Stale || string(got.Body) != "it is ok") {
+				t.Errorf("Client.Request() = %+v, want stale body", got)
+			}
+		})
+	}
+}
+
+func TestClient_RequestStaleIfUnreachable(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, "it is ok")
+	}))
+
+	h, err := newClient(ts.URL, &Options{StaleIfError: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	withoutRetryWait(h)
+
+	if _, err := h.Request("test", ""); err != nil {
+		t.Fatal(err)
+	}
+	ts.Close()
+
+	got, err := h.Request("test", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !got.Stale {
+		t.Errorf("Client.Request() = %+v, want stale", got)
+	}
+
+	if _, err := h.Request("other", ""); err == nil || errors.As(err, new(*HTTPError)) {
+		t.Errorf("Client.Request() error = %v, want transport error", err)
+	}
+}
+
+func TestStaleStore_Bounded(t *testing.T) {
+	s := newStaleStore(&Options{CacheSize: 2})
+	for _, key := range []string{"a", "b", "c"} {
+		s.store(key, &Response{Body: []byte(key)})
+	}
+
+	if got := s.load("a"); got != nil {
+		t.Errorf("staleStore.load(a) = %+v, want evicted", got)
+	}
+	if got := s.load("c"); got == nil || string(got.Body) != "c" {
+		t.Errorf("staleStore.load(c) = %+v, want c", got)
+	}
+}
+
+func TestSTNS_GetUserByNameStale(t *testing.T) {
+	var down int32
+	var requests int32
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&requests, 1)
+		if atomic.LoadInt32(&down) == 1 {
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		fmt.Fprint(w, `[{"name":"alice","id":1}]`)
+	}))
+	defer ts.Close()
+
+	s, err := NewSTNS(ts.URL, &Options{StaleIfError: true, Cache: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	withoutRetryWait(s.client)
+
+	ctx, info := WithResponseInfo(context.Background())
+	if _, err := s.GetUserByNameContext(ctx, "alice"); err != nil {
+		t.Fatal(err)
+	}
+	if info.Stale() {
+		t.Error("ResponseInfo.Stale() = true, want false")
+	}
+
+	s.PurgeCache()
+	atomic.StoreInt32(&down, 1)
+
+	ctx, info = WithResponseInfo(context.Background())
+	got, err := s.GetUserByNameContext(ctx, "alice")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got.Name != "alice" || !info.Stale() {
+		t.Errorf("STNS.GetUserByNameContext() = %+v stale = %v, want stale alice", got, info.Stale())
+	}
+
+	// a stale result must not be cached as fresh
+	atomic.StoreInt32(&down, 0)
+	before := atomic.LoadInt32(&requests)
+	ctx, info = WithResponseInfo(context.Background())
+	if _, err := s.GetUserByNameContext(ctx, "alice"); err != nil {
+		t.Fatal(err)
+	}
+	if atomic.LoadInt32(&requests) == before || info.Stale() {
+		t.Error("STNS.GetUserByNameContext() served the stale result from the cache")
+	}
+}
@@ -1,15 +1,17 @@
 package libstns
 
 import (
+	"context"
 	"crypto/rand"
 	"encoding/json"
 	"errors"
 	"fmt"
 	"io/ioutil"
-	"os"
+	"net/url"
 	"os/user"
-	"path"
+	"strconv"
 	"strings"
+	"sync"
 
 	"github.com/STNS/STNS/v2/model"
 	"github.com/caarlos0/env"
@@ -19,24 +21,18 @@ import (
 type STNS struct {
 	client             *client
 	opt                *Options
+	cache              *cache
+	snapshot           *Snapshot
+	snapshotMu         sync.RWMutex
+	userIDRange        idRangeState
+	groupIDRange       idRangeState
+	challengeStore     ChallengeStore
 	makeChallengeCode  func() ([]byte, error)
 	storeChallengeCode func(string, []byte) error
 	popChallengeCode   func(string) ([]byte, error)
-}
-
-func DefaultStoreChallengeCode(user string, code []byte) error {
-	fmt.Sprint(path.Join(os.TempDir(), user))
-	err := ioutil.WriteFile(path.Join(os.TempDir(), user), code, 0600)
-	if err != nil {
-		return err
-	}
-	return nil
-}
-
-func DefaultPopChallengeCode(user string) ([]byte, error) {
-	p := path.Join(os.TempDir(), user)
-	defer os.Remove(p)
-	return ioutil.ReadFile(p)
+	signerMu           sync.Mutex
+	customSigner       ssh.Signer
+	fileSigner         ssh.Signer
 }
 
 func DefaultMakeChallengeCode() ([]byte, error) {
@@ -55,172 +51,307 @@ func DefaultMakeChallengeCode() ([]byte, error) {
 }
 
 type Options struct {
-	AuthToken          string `env:"STNS_AUTH_TOKEN"`
-	User               string `env:"STNS_USER"`
-	Password           string `env:"STNS_PASSWORD"`
-	UserAgent          string
-	SkipSSLVerify      bool `env:"STNS_SKIP_VERIFY"`
-	HttpProxy          string
-	HttpKeepalive      bool `env:"STNS_HTTP_KEEPALIVE"`
-	RequestTimeout     int  `env:"STNS_REQUEST_TIMEOUT"`
-	RequestRetry       int  `env:"STNS_REQUEST_RETRY"`
-	HttpHeaders        map[string]string
-	TLS                TLS
-	PrivatekeyPath     string `env:"STNS_PRIVATE_KEY"`
-	PrivatekeyPassword string `env:"STNS_PRIVATE_KEY_PASSWORD"`
+	AuthToken               string `env:"STNS_AUTH_TOKEN"`
+	User                    string `env:"STNS_USER"`
+	Password                string `env:"STNS_PASSWORD"`
+	UserAgent               string
+	SkipSSLVerify           bool `env:"STNS_SKIP_VERIFY"`
+	HttpProxy               string
+	HttpKeepalive           bool `env:"STNS_HTTP_KEEPALIVE"`
+	RequestTimeout          int  `env:"STNS_REQUEST_TIMEOUT"`
+	RequestRetry            int  `env:"STNS_REQUEST_RETRY"`
+	HttpHeaders             map[string]string
+	TLS                     TLS
+	PrivatekeyPath          string   `env:"STNS_PRIVATE_KEY"`
+	PrivatekeyPassword      string   `env:"STNS_PRIVATE_KEY_PASSWORD"`
+	Cache                   bool     `env:"STNS_CACHE"`
+	CacheTTL                int      `env:"STNS_CACHE_TTL"`
+	CacheNegativeTTL        int      `env:"STNS_CACHE_NEGATIVE_TTL"`
+	CacheSize               int      `env:"STNS_CACHE_SIZE"`
+	StaleIfError            bool     `env:"STNS_STALE_IF_ERROR"`
+	MaxStaleness            int      `env:"STNS_MAX_STALENESS"`
+	SnapshotDir             string   `env:"STNS_SNAPSHOT_DIR"`
+	IDRangeMaxAge           int      `env:"STNS_ID_RANGE_MAX_AGE"`
+	EndpointPolicy          string   `env:"STNS_ENDPOINT_POLICY"`
+	EndpointBackoff         int      `env:"STNS_ENDPOINT_BACKOFF"`
+	ConditionalRequest      bool     `env:"STNS_CONDITIONAL_REQUEST"`
+	ChallengeTTL            int      `env:"STNS_CHALLENGE_TTL"`
+	ChallengeDir            string   `env:"STNS_CHALLENGE_DIR"`
+	SSHAgent                bool     `env:"STNS_SSH_AGENT"`
+	SSHAgentKey             string   `env:"STNS_SSH_AGENT_KEY"`
+	SignatureFormat         string   `env:"STNS_SIGNATURE_FORMAT"`
+	SignatureNamespace      string   `env:"STNS_SIGNATURE_NAMESPACE"`
+	TrustedUserCAKeys       string   `env:"STNS_TRUSTED_USER_CA_KEYS"`
+	CertCriticalOptions     []string `env:"STNS_CERT_CRITICAL_OPTIONS"`
+	RevokedCertSerials      []uint64 `env:"STNS_REVOKED_CERT_SERIALS"`
+	KeyOptionsPolicy        bool     `env:"STNS_KEY_OPTIONS_POLICY"`
+	RejectKeyOptions        []string `env:"STNS_REJECT_KEY_OPTIONS"`
+	VerifyWorkers           int      `env:"STNS_VERIFY_WORKERS"`
+	AllowedKeyTypes         []string `env:"STNS_ALLOWED_KEY_TYPES"`
+	MinRSAKeySize           int      `env:"STNS_MIN_RSA_KEY_SIZE"`
+	AllowedSignatureFormats []string `env:"STNS_ALLOWED_SIGNATURE_FORMATS"`
+	StrictKeyParsing        bool     `env:"STNS_STRICT_KEY_PARSING"`
 }
 
 func NewSTNS(endpoint string, opt *Options) (*STNS, error) {
+	return NewSTNSWithEndpoints([]string{endpoint}, opt)
+}
+
+// NewSTNSWithEndpoints creates a client that fails over between endpoints
+// according to Options.EndpointPolicy.
+func NewSTNSWithEndpoints(endpoints []string, opt *Options) (*STNS, error) {
 	if opt == nil {
 		opt = &Options{}
 	}
 	s := &STNS{
-		popChallengeCode:   DefaultPopChallengeCode,
-		storeChallengeCode: DefaultStoreChallengeCode,
-		makeChallengeCode:  DefaultMakeChallengeCode,
+		makeChallengeCode: DefaultMakeChallengeCode,
 	}
 	if err := env.Parse(s); err != nil {
 		return nil, err
 	}
-	c, err := newClient(endpoint, opt)
+	c, err := newClientWithEndpoints(endpoints, opt)
 	if err != nil {
 		return nil, err
 	}
 	s.client = c
 	s.opt = opt
+	s.challengeStore = NewFileChallengeStore(opt.ChallengeDir)
+	if opt.Cache {
+		s.cache = newCache(opt)
+	}
+	s.loadSnapshotOnStartup()
 	return s, nil
 }
 
 const usersEndpoint = "/users"
 const groupsEndpoint = "/groups"
 
-func (s *STNS) SetStoreChallengeCode(f func(string, []byte) error) {
-	s.storeChallengeCode = f
+func (s *STNS) Request(path, query string) (*Response, error) {
+	return s.RequestContext(context.Background(), path, query)
 }
 
-func (s *STNS) SetPopChallengeCode(f func(string) ([]byte, error)) {
-	s.popChallengeCode = f
+func (s *STNS) RequestContext(ctx context.Context, path, query string) (*Response, error) {
+	return s.client.RequestContext(ctx, path, query)
 }
 
-func (s *STNS) Request(path, query string) (*Response, error) {
-	return s.client.Request(path, query)
+func (s *STNS) EndpointStatus() []EndpointStatus {
+	return s.client.endpointStatus()
 }
 
 func (s *STNS) ListUser() ([]*model.User, error) {
-	r, err := s.client.Request(usersEndpoint, "")
+	return s.ListUserContext(context.Background())
+}
+
+func (s *STNS) ListUserContext(ctx context.Context) ([]*model.User, error) {
+	r, err := s.client.RequestContext(ctx, usersEndpoint, "")
 	if err != nil {
+		if v := s.snapshotUsers(ctx, err); v != nil {
+			return v, nil
+		}
 		return nil, err
 	}
+	s.observeIDRange(r)
 	v := []*model.User{}
 	if err := json.Unmarshal(r.Body, &v); err != nil {
 		return nil, err
 	}
 
+	if !r.Stale {
+		for _, u := range v {
+			s.storeUser("", u, nil)
+		}
+	}
 	return v, nil
 }
 
 func (s *STNS) GetUserByName(name string) (*model.User, error) {
-	r, err := s.client.Request(usersEndpoint, fmt.Sprintf("name=%s", name))
-	if err != nil {
-		return nil, err
-	}
-	v := []*model.User{}
-	if err := json.Unmarshal(r.Body, &v); err != nil {
+	return s.GetUserByNameContext(context.Background(), name)
+}
+
+func (s *STNS) GetUserByNameContext(ctx context.Context, name string) (*model.User, error) {
+	if err := ValidateName(name); err != nil {
 		return nil, err
 	}
 
-	if len(v) == 0 {
-		return nil, errors.New("user not found")
+	key := userNameKey(name)
+	if u, ok, err := s.cachedUser(key); ok {
+		return u, err
 	}
 
-	return v[0], nil
+	u, stale, err := s.getUser(ctx, url.Values{"name": {name}}.Encode(), func(u *model.User) bool {
+		return u.Name == name
+	})
+	if !stale {
+		s.storeUser(key, u, err)
+	}
+	return u, err
 }
 
 func (s *STNS) GetUserByID(id int) (*model.User, error) {
-	r, err := s.client.Request(usersEndpoint, fmt.Sprintf("id=%d", id))
+	return s.GetUserByIDContext(context.Background(), id)
+}
+
+func (s *STNS) GetUserByIDContext(ctx context.Context, id int) (*model.User, error) {
+	key := userIDKey(id)
+	if u, ok, err := s.cachedUser(key); ok {
+		return u, err
+	}
+
+	u, stale, err := s.getUser(ctx, url.Values{"id": {strconv.Itoa(id)}}.Encode(), func(u *model.User) bool {
+		return u.ID == id
+	})
+	if !stale {
+		s.storeUser(key, u, err)
+	}
+	return u, err
+}
+
+// getUser also reports whether the result was served stale, in which case
+// it must not be cached.
+func (s *STNS) getUser(ctx context.Context, query string, match func(*model.User) bool) (*model.User, bool, error) {
+	r, err := s.client.RequestContext(ctx, usersEndpoint, query)
 	if err != nil {
-		return nil, err
+		if isNotFound(err) {
+			return nil, false, ErrUserNotFound
+		}
+		if v := s.snapshotUsers(ctx, err); v != nil {
+			for _, u := range v {
+				if match(u) {
+					return u, true, nil
+				}
+			}
+			return nil, true, ErrUserNotFound
+		}
+		return nil, false, err
 	}
+	s.observeIDRange(r)
 	v := []*model.User{}
 	if err := json.Unmarshal(r.Body, &v); err != nil {
-		return nil, err
+		return nil, false, err
 	}
 
 	if len(v) == 0 {
-		return nil, errors.New("user not found")
+		return nil, r.Stale, ErrUserNotFound
 	}
 
-	return v[0], nil
+	return v[0], r.Stale, nil
 }
 
 func (s *STNS) ListGroup() ([]*model.Group, error) {
-	r, err := s.client.Request(groupsEndpoint, "")
+	return s.ListGroupContext(context.Background())
+}
+
+func (s *STNS) ListGroupContext(ctx context.Context) ([]*model.Group, error) {
+	r, err := s.client.RequestContext(ctx, groupsEndpoint, "")
 	if err != nil {
+		if v := s.snapshotGroups(ctx, err); v != nil {
+			return v, nil
+		}
 		return nil, err
 	}
+	s.observeIDRange(r)
 	v := []*model.Group{}
 	if err := json.Unmarshal(r.Body, &v); err != nil {
 		return nil, err
 	}
 
+	if !r.Stale {
+		for _, g := range v {
+			s.storeGroup("", g, nil)
+		}
+	}
 	return v, nil
 }
 
 func (s *STNS) GetGroupByName(name string) (*model.Group, error) {
-	r, err := s.client.Request(groupsEndpoint, fmt.Sprintf("name=%s", name))
-	if err != nil {
-		return nil, err
-	}
-	v := []*model.Group{}
-	if err := json.Unmarshal(r.Body, &v); err != nil {
+	return s.GetGroupByNameContext(context.Background(), name)
+}
+
+func (s *STNS) GetGroupByNameContext(ctx context.Context, name string) (*model.Group, error) {
+	if err := ValidateName(name); err != nil {
 		return nil, err
 	}
 
-	if len(v) == 0 {
-		return nil, errors.New("group not found")
+	key := groupNameKey(name)
+	if g, ok, err := s.cachedGroup(key); ok {
+		return g, err
 	}
 
-	return v[0], nil
+	g, stale, err := s.getGroup(ctx, url.Values{"name": {name}}.Encode(), func(g *model.Group) bool {
+		return g.Name == name
+	})
+	if !stale {
+		s.storeGroup(key, g, err)
+	}
+	return g, err
 }
 
 func (s *STNS) GetGroupByID(id int) (*model.Group, error) {
-	r, err := s.client.Request(groupsEndpoint, fmt.Sprintf("id=%d", id))
+	return s.GetGroupByIDContext(context.Background(), id)
+}
+
+func (s *STNS) GetGroupByIDContext(ctx context.Context, id int) (*model.Group, error) {
+	key := groupIDKey(id)
+	if g, ok, err := s.cachedGroup(key); ok {
+		return g, err
+	}
+
+	g, stale, err := s.getGroup(ctx, url.Values{"id": {strconv.Itoa(id)}}.Encode(), func(g *model.Group) bool {
+		return g.ID == id
+	})
+	if !stale {
+		s.storeGroup(key, g, err)
+	}
+	return g, err
+}
+
+// getGroup also reports whether the result was served stale, in which case
+// it must not be cached.
+func (s *STNS) getGroup(ctx context.Context, query string, match func(*model.Group) bool) (*model.Group, bool, error) {
+	r, err := s.client.RequestContext(ctx, groupsEndpoint, query)
 	if err != nil {
-		return nil, err
+		if isNotFound(err) {
+			return nil, false, ErrGroupNotFound
+		}
+		if v := s.snapshotGroups(ctx, err); v != nil {
+			for _, g := range v {
+				if match(g) {
+					return g, true, nil
+				}
+			}
+			return nil, true, ErrGroupNotFound
+		}
+		return nil, false, err
 	}
+	s.observeIDRange(r)
 	v := []*model.Group{}
 	if err := json.Unmarshal(r.Body, &v); err != nil {
-		return nil, err
+		return nil, false, err
 	}
 
 	if len(v) == 0 {
-		return nil, errors.New("group not found")
+		return nil, r.Stale, ErrGroupNotFound
 	}
 
-	return v[0], nil
-}
-func (c *STNS) CreateUserChallengeCode(name string) ([]byte, error) {
-	code, err := c.makeChallengeCode()
-	if err != nil {
-		return nil, err
-	}
-	err = c.storeChallengeCode(name, code)
-	if err != nil {
-		return nil, err
-	}
-	return code, nil
-}
-
-func (c *STNS) PopUserChallengeCode(name string) ([]byte, error) {
-	return c.popChallengeCode(name)
+	return v[0], r.Stale, nil
 }
 
 func (c *STNS) Sign(code []byte) ([]byte, error) {
-	privateKey, err := c.loadPrivateKey()
+	privateKey, release, err := c.signer()
 	if err != nil {
 		return nil, err
 	}
-	sig, err := privateKey.Sign(rand.Reader, code)
+	defer release()
+
+	switch c.signatureFormat() {
+	case SignatureFormatJSON:
+	case SignatureFormatSSHSIG:
+		return SignSSHSIG(privateKey, code, c.signatureNamespace())
+	default:
+		return nil, fmt.Errorf("unknown signature format:%s", c.signatureFormat())
+	}
+
+	sig, err := signData(privateKey, code)
 	if err != nil {
 		return nil, err
 	}
@@ -234,33 +365,27 @@ func (c *STNS) Sign(code []byte) ([]byte, error) {
 }
 
 func (c *STNS) VerifyWithUser(name string, msg, signature []byte) error {
-	user, err := c.GetUserByName(name)
-	if err != nil {
-		return err
-	}
+	return c.VerifyWithUserContext(context.Background(), name, msg, signature)
+}
 
-	return c.Verify(msg, []byte(strings.Join(user.Keys, "\n")), signature)
+func (c *STNS) VerifyWithUserContext(ctx context.Context, name string, msg, signature []byte) error {
+	_, err := c.VerifyWithUserResultContext(ctx, name, msg, signature)
+	return err
 }
 
 func (c *STNS) Verify(msg, publicKeyBytes, signature []byte) error {
-	for len(publicKeyBytes) > 0 {
-		publicKey, _, _, rest, err := ssh.ParseAuthorizedKey(publicKeyBytes)
-		if err != nil {
-			return fmt.Errorf("can't read public key %s", err.Error())
-		}
-
-		var sig ssh.Signature
-		if err := json.Unmarshal(signature, &sig); err != nil {
-			return err
-		}
-
-		if err := publicKey.Verify(msg, &sig); err == nil {
-			return nil
-		}
-		publicKeyBytes = rest
-	}
-	return errors.New("verify failed")
+	return c.VerifyContext(context.Background(), msg, publicKeyBytes, signature)
+}
 
+// VerifyContext checks signature against the authorized keys in
+// publicKeyBytes. Both the JSON format and the armored SSHSIG format are
+// accepted. With Options.KeyOptionsPolicy, a matching key is only accepted
+// when its options allow it, using the client address set by
+// WithClientAddress. Comments, blank lines and malformed keys are skipped
+// unless Options.StrictKeyParsing is set.
+func (c *STNS) VerifyContext(ctx context.Context, msg, publicKeyBytes, signature []byte) error {
+	_, err := c.VerifyWithResultContext(ctx, msg, publicKeyBytes, signature)
+	return err
 }
 
 func (c *STNS) loadPrivateKey() (ssh.Signer, error) {
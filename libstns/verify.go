@@ -0,0 +1,238 @@
+package libstns
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/STNS/STNS/v2/model"
+	"github.com/sirupsen/logrus"
+	"golang.org/x/crypto/ssh"
+)
+
+var (
+	ErrKeyParse          = errors.New("can't read public key")
+	ErrSignatureMismatch = errors.New("signature mismatch")
+)
+
+// VerifyResult describes the key that verified a signature.
+type VerifyResult struct {
+	// User is the user owning the key, nil for Verify.
+	User        *model.User
+	PublicKey   ssh.PublicKey
+	Fingerprint string
+	Type        string
+	Comment     string
+	// Index is the position of the key in User.Keys, or the line number
+	// of the key for Verify. It is -1 for a certificate.
+	Index int
+	// Warnings lists the malformed keys skipped before the match.
+	Warnings []*KeyError
+}
+
+// KeyError is the reason one authorized key did not verify a signature.
+type KeyError struct {
+	Index       int
+	Fingerprint string
+	Err         error
+}
+
+func (e *KeyError) Error() string {
+	if e.Fingerprint == "" {
+		return fmt.Sprintf("key %d: %s", e.Index, e.Err.Error())
+	}
+	return fmt.Sprintf("key %d %s: %s", e.Index, e.Fingerprint, e.Err.Error())
+}
+
+func (e *KeyError) Unwrap() error {
+	return e.Err
+}
+
+// VerifyError is returned when no key verified a signature. It matches
+// ErrVerifyFailed and the error of each key with errors.Is.
+type VerifyError struct {
+	Keys []*KeyError
+}
+
+func (e *VerifyError) Error() string {
+	if len(e.Keys) == 0 {
+		return ErrVerifyFailed.Error() + ": no keys"
+	}
+
+	msgs := []string{}
+	for _, k := range e.Keys {
+		msgs = append(msgs, k.Error())
+	}
+	return ErrVerifyFailed.Error() + ": " + strings.Join(msgs, ", ")
+}
+
+func (e *VerifyError) Is(target error) bool {
+	return target == ErrVerifyFailed
+}
+
+func (e *VerifyError) Unwrap() []error {
+	errs := []error{}
+	for _, k := range e.Keys {
+		errs = append(errs, k)
+	}
+	return errs
+}
+
+type authorizedKeyLine struct {
+	index int
+	line  []byte
+}
+
+func (c *STNS) VerifyWithUserResult(name string, msg, signature []byte) (*VerifyResult, error) {
+	return c.VerifyWithUserResultContext(context.Background(), name, msg, signature)
+}
+
+// VerifyWithUserResultContext is like VerifyWithUserContext but also
+// returns the key that matched.
+func (c *STNS) VerifyWithUserResultContext(ctx context.Context, name string, msg, signature []byte) (*VerifyResult, error) {
+	user, err := c.GetUserByNameContext(ctx, name)
+	if err != nil {
+		return nil, err
+	}
+	return c.verifyUser(ctx, user, msg, signature)
+}
+
+func (c *STNS) VerifyWithResult(msg, publicKeyBytes, signature []byte) (*VerifyResult, error) {
+	return c.VerifyWithResultContext(context.Background(), msg, publicKeyBytes, signature)
+}
+
+// VerifyWithResultContext is like VerifyContext but also returns the key
+// that matched.
+func (c *STNS) VerifyWithResultContext(ctx context.Context, msg, publicKeyBytes, signature []byte) (*VerifyResult, error) {
+	lines := []authorizedKeyLine{}
+	for i, l := range bytes.Split(publicKeyBytes, []byte("\n")) {
+		lines = append(lines, authorizedKeyLine{index: i, line: l})
+	}
+	return c.verifyAuthorizedKeys(ctx, msg, lines, signature)
+}
+
+func (c *STNS) verifyUser(ctx context.Context, user *model.User, msg, signature []byte) (*VerifyResult, error) {
+	if cert, ok := sshsigCertificate(signature); ok {
+		if err := c.verifyCertificate(ctx, user.Name, msg, cert, signature); err != nil {
+			return nil, err
+		}
+
+		return &VerifyResult{
+			User:        user,
+			PublicKey:   cert,
+			Fingerprint: ssh.FingerprintSHA256(cert),
+			Type:        cert.Type(),
+			Comment:     cert.KeyId,
+			Index:       -1,
+		}, nil
+	}
+
+	lines := []authorizedKeyLine{}
+	for i, k := range user.Keys {
+		for _, l := range bytes.Split([]byte(k), []byte("\n")) {
+			lines = append(lines, authorizedKeyLine{index: i, line: l})
+		}
+	}
+
+	r, err := c.verifyAuthorizedKeys(ctx, msg, lines, signature)
+	if err != nil {
+		return nil, err
+	}
+	r.User = user
+	return r, nil
+}
+
+func (c *STNS) verifyAuthorizedKeys(ctx context.Context, msg []byte, lines []authorizedKeyLine, signature []byte) (*VerifyResult, error) {
+	var match func(ssh.PublicKey) error
+	if isSSHSIG(signature) {
+		format, err := sshsigFormat(signature)
+		if err != nil {
+			return nil, err
+		}
+
+		if err := c.checkSignaturePolicy(format); err != nil {
+			return nil, err
+		}
+
+		signer, err := VerifySSHSIG(msg, signature, c.signatureNamespace())
+		if err != nil {
+			return nil, err
+		}
+
+		match = func(publicKey ssh.PublicKey) error {
+			if !bytes.Equal(publicKey.Marshal(), signer.Marshal()) {
+				return ErrSignatureMismatch
+			}
+			return nil
+		}
+	} else {
+		var sig ssh.Signature
+		if err := json.Unmarshal(signature, &sig); err != nil {
+			return nil, err
+		}
+
+		if err := c.checkSignaturePolicy(sig.Format); err != nil {
+			return nil, err
+		}
+
+		match = func(publicKey ssh.PublicKey) error {
+			if err := publicKey.Verify(msg, &sig); err != nil {
+				return ErrSignatureMismatch
+			}
+			return nil
+		}
+	}
+
+	verr := &VerifyError{}
+	var warnings []*KeyError
+	for _, l := range lines {
+		if line := bytes.TrimSpace(l.line); len(line) == 0 || line[0] == '#' {
+			continue
+		}
+
+		publicKey, comment, options, _, err := ssh.ParseAuthorizedKey(l.line)
+		if err != nil {
+			kerr := &KeyError{
+				Index: l.index,
+				Err:   fmt.Errorf("%w %s", ErrKeyParse, err.Error()),
+			}
+			verr.Keys = append(verr.Keys, kerr)
+			if c.opt != nil && c.opt.StrictKeyParsing {
+				return nil, verr
+			}
+
+			logrus.Warnf("skip malformed public key:%s", kerr.Error())
+			warnings = append(warnings, kerr)
+			continue
+		}
+
+		fingerprint := ssh.FingerprintSHA256(publicKey)
+		if err := c.checkKeyPolicy(publicKey); err != nil {
+			verr.Keys = append(verr.Keys, &KeyError{Index: l.index, Fingerprint: fingerprint, Err: err})
+			continue
+		}
+
+		if err := match(publicKey); err != nil {
+			verr.Keys = append(verr.Keys, &KeyError{Index: l.index, Fingerprint: fingerprint, Err: err})
+			continue
+		}
+
+		if err := c.checkKeyOptions(ctx, options); err != nil {
+			verr.Keys = append(verr.Keys, &KeyError{Index: l.index, Fingerprint: fingerprint, Err: err})
+			continue
+		}
+
+		return &VerifyResult{
+			PublicKey:   publicKey,
+			Fingerprint: fingerprint,
+			Type:        publicKey.Type(),
+			Comment:     comment,
+			Index:       l.index,
+			Warnings:    warnings,
+		}, nil
+	}
+	return nil, verr
+}
@@ -0,0 +1,183 @@
+package libstns
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/STNS/STNS/v2/model"
+	"golang.org/x/crypto/ssh"
+)
+
+func authorizedKey(s ssh.Signer, comment string) string {
+	return strings.TrimSpace(string(ssh.MarshalAuthorizedKey(s.PublicKey()))) + " " + comment
+}
+
+func TestSTNS_VerifyWithUserResult(t *testing.T) {
+	signer := newTestSigner(t)
+	other := newTestSigner(t)
+
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		users := []*model.User{
+			{
+				Base: model.Base{ID: 1, Name: "alice"},
+				Keys: []string{
+					authorizedKey(other, "alice@desktop"),
+					authorizedKey(signer, "alice@laptop"),
+				},
+			},
+		}
+		rp, err := json.Marshal(users)
+		if err != nil {
+			t.Error(err)
+		}
+		fmt.Fprint(w, string(rp))
+	}))
+	defer ts.Close()
+
+	s, err := NewSTNS(ts.URL, &Options{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	s.SetSigner(signer)
+
+	sig, err := s.Sign([]byte("test"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	got, err := s.VerifyWithUserResult("alice", []byte("test"), sig)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if got.User.Name != "alice" {
+		t.Errorf("VerifyResult.User = %s, want alice", got.User.Name)
+	}
+	if got.Index != 1 {
+		t.Errorf("VerifyResult.Index = %d, want 1", got.Index)
+	}
+	if got.Fingerprint != ssh.FingerprintSHA256(signer.PublicKey()) {
+		t.Errorf("VerifyResult.Fingerprint = %s, want %s", got.Fingerprint, ssh.FingerprintSHA256(signer.PublicKey()))
+	}
+	if got.Type != ssh.KeyAlgoED25519 {
+		t.Errorf("VerifyResult.Type = %s, want %s", got.Type, ssh.KeyAlgoED25519)
+	}
+	if got.Comment != "alice@laptop" {
+		t.Errorf("VerifyResult.Comment = %s, want alice@laptop", got.Comment)
+	}
+}
+
+func TestSTNS_VerifyError(t *testing.T) {
+	signer := newTestSigner(t)
+	other := newTestSigner(t)
+
+	c := &STNS{opt: &Options{}}
+	c.SetSigner(signer)
+
+	sig, err := c.Sign([]byte("test"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name    string
+		keys    string
+		wantErr error
+		want    []int
+	}{
+		{
+			name:    "mismatch",
+			keys:    authorizedKey(other, "a") + "\n# comment\n\n" + authorizedKey(other, "b"),
+			wantErr: ErrSignatureMismatch,
+			want:    []int{0, 3},
+		},
+		{
+			name:    "parse error",
+			keys:    authorizedKey(other, "a") + "\nssh-ed25519 AAAA",
+			wantErr: ErrKeyParse,
+			want:    []int{0, 1},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := c.VerifyWithResult([]byte("test"), []byte(tt.keys), sig)
+			if !errors.Is(err, ErrVerifyFailed) {
+				t.Errorf("STNS.VerifyWithResult() error = %v, want %v", err, ErrVerifyFailed)
+			}
+			if !errors.Is(err, tt.wantErr) {
+				t.Errorf("STNS.VerifyWithResult() error = %v, want %v", err, tt.wantErr)
+			}
+
+			var verr *VerifyError
+			if !errors.As(err, &verr) {
+				t.Fatalf("STNS.VerifyWithResult() error = %T, want *VerifyError", err)
+			}
+
+			got := []int{}
+			for _, k := range verr.Keys {
+				got = append(got, k.Index)
+			}
+			if fmt.Sprint(got) != fmt.Sprint(tt.want) {
+				t.Errorf("VerifyError.Keys indexes = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestSTNS_VerifyMalformedKeys(t *testing.T) {
+	signer := newTestSigner(t)
+
+	c := &STNS{opt: &Options{}}
+	c.SetSigner(signer)
+
+	sig, err := c.Sign([]byte("test"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	keys := "ssh-ed25519 AAAA broken\n# comment\n\nnot a key\n" + authorizedKey(signer, "valid")
+
+	tests := []struct {
+		name   string
+		strict bool
+	}{
+		{name: "lenient"},
+		{name: "strict", strict: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c.opt.StrictKeyParsing = tt.strict
+
+			got, err := c.VerifyWithResult([]byte("test"), []byte(keys), sig)
+			if tt.strict {
+				if !errors.Is(err, ErrKeyParse) {
+					t.Errorf("STNS.VerifyWithResult() error = %v, want %v", err, ErrKeyParse)
+				}
+				return
+			}
+
+			if err != nil {
+				t.Fatalf("STNS.VerifyWithResult() error = %v", err)
+			}
+			if got.Index != 4 {
+				t.Errorf("VerifyResult.Index = %d, want 4", got.Index)
+			}
+
+			indexes := []int{}
+			for _, w := range got.Warnings {
+				if !errors.Is(w, ErrKeyParse) {
+					t.Errorf("VerifyResult.Warnings = %v, want %v", w, ErrKeyParse)
+				}
+				indexes = append(indexes, w.Index)
+			}
+			if fmt.Sprint(indexes) != "[0 3]" {
+				t.Errorf("VerifyResult.Warnings indexes = %v, want [0 3]", indexes)
+			}
+		})
+	}
+}